@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,16 +17,74 @@ import (
 )
 
 const (
-	categoryMetrics     = "METRICS:"
-	categoryServer      = "SERVER:"
-	categoryTransponder = "TRANSPONDER:"
+	categoryMetrics       = "METRICS:"
+	categoryPathDiscovery = "PATH DISCOVERY:"
+	categoryResponder     = "RESPONDER:"
+	categoryServer        = "SERVER:"
+	categoryTransponder   = "TRANSPONDER:"
+)
+
+var (
+	latencyHistograms = []string{
+		config.HistogramExplicit,
+		config.HistogramExponential,
+	}
+
+	metricsExporters = []string{
+		config.ExporterOTLPGRPC,
+		config.ExporterOTLPHTTP,
+		config.ExporterPrometheus,
+	}
+
+	transponderModes = []string{
+		config.ModeBoth,
+		config.ModeInitiator,
+		config.ModeResponder,
+	}
 )
 
 func CommandServe(cfg *config.Config) *cli.Command {
+	metricsAllowedLocations := &cli.StringSlice{}
+	metricsExporterNames := &cli.StringSlice{}
 	metricsLabels := &cli.StringSlice{}
+	metricsLatencyBucketProfiles := &cli.StringSlice{}
+	metricsLatencyBuckets := &cli.StringSlice{}
+	metricsOTLPHeaders := &cli.StringSlice{}
+	metricsQuantileWindows := &cli.StringSlice{}
+	metricsQuantiles := &cli.Float64Slice{}
+	responderAllowedNetworks := &cli.StringSlice{}
+	transponderListenAddresses := &cli.StringSlice{}
 	transponderPeers := &cli.StringSlice{}
+	transponderQUICListenAddresses := &cli.StringSlice{}
+	transponderStreamListenAddresses := &cli.StringSlice{}
+	transponderTWAMPListenAddresses := &cli.StringSlice{}
 
 	metricsFlags := []cli.Flag{
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsAllowedLocations,
+			EnvVars:     []string{envPrefix + "METRICS_ALLOWED_LOCATIONS"},
+			Name:        "metrics-allowed-location",
+			Usage:       "`location` of the peers to be reported as is in 'from' and 'to' labels (the rest are reported as 'other'; any by default)",
+		},
+
+		&cli.BoolFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.Exemplars,
+			EnvVars:     []string{envPrefix + "METRICS_EXEMPLARS"},
+			Name:        "metrics-exemplars",
+			Usage:       "attach the exemplars (with the probe's sequence and timestamps) to the forward and return latency histograms",
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsExporterNames,
+			EnvVars:     []string{envPrefix + "METRICS_EXPORTERS"},
+			Name:        "metrics-exporter",
+			Usage:       "`exporter` of the metrics (allowed values: " + strings.Join(metricsExporters, ", ") + ")",
+			Value:       cli.NewStringSlice(config.ExporterPrometheus),
+		},
+
 		&cli.StringSliceFlag{
 			Category:    categoryMetrics,
 			Destination: metricsLabels,
@@ -32,6 +93,22 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			Usage:       "extra metrics labels in the format `label=value`",
 		},
 
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsLatencyBucketProfiles,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_BUCKET_PROFILES"},
+			Name:        "metrics-latency-bucket-profile",
+			Usage:       "named profile of latency histogram buckets in the format `name=microseconds microseconds ...` (assigned to the peers with their 'buckets' option)",
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsLatencyBuckets,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_BUCKETS"},
+			Name:        "metrics-latency-buckets",
+			Usage:       "exact `microseconds` boundaries of latency histogram buckets (overrides the generated ones)",
+		},
+
 		&cli.IntFlag{
 			Category:    categoryMetrics,
 			Destination: &cfg.Metrics.LatencyBucketsCount,
@@ -41,6 +118,42 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			Value:       33,
 		},
 
+		&cli.Float64Flag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.LatencyEWMAAlpha,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_EWMA_ALPHA"},
+			Name:        "metrics-latency-ewma-alpha",
+			Usage:       "smoothing `factor` of the moving averages of latencies (0..1; the larger it is, the less the smoothing)",
+			Value:       0.1,
+		},
+
+		&cli.StringFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.LatencyHistogram,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_HISTOGRAM"},
+			Name:        "metrics-latency-histogram",
+			Usage:       "`kind` of latency histograms (allowed values: " + strings.Join(latencyHistograms, ", ") + ")",
+			Value:       config.HistogramExplicit,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.LatencyHistogramMaxScale,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_HISTOGRAM_MAX_SCALE"},
+			Name:        "metrics-latency-histogram-max-scale",
+			Usage:       "max `scale` of exponential latency histograms (-10..20; the buckets grow by 2^(2^-scale))",
+			Value:       20,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.LatencyHistogramMaxSize,
+			EnvVars:     []string{envPrefix + "METRICS_LATENCY_HISTOGRAM_MAX_SIZE"},
+			Name:        "metrics-latency-histogram-max-size",
+			Usage:       "max `count` of exponential latency histogram buckets (the scale is reduced to fit the observed range into them)",
+			Value:       160,
+		},
+
 		&cli.StringFlag{
 			Category:    categoryMetrics,
 			Destination: &cfg.Metrics.ListenAddress,
@@ -67,9 +180,113 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			Usage:       "`microseconds` value for the largest histogram latency bucket",
 			Value:       1000000,
 		},
+
+		&cli.IntFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.MaxLocations,
+			EnvVars:     []string{envPrefix + "METRICS_MAX_LOCATIONS"},
+			Name:        "metrics-max-locations",
+			Usage:       "max `count` of distinct locations per label of each metric (the rest are reported as 'other'; 0 for no limit)",
+			Value:       100,
+		},
+
+		&cli.StringFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.OTLPEndpoint,
+			EnvVars:     []string{envPrefix + "METRICS_OTLP_ENDPOINT"},
+			Name:        "metrics-otlp-endpoint",
+			Usage:       "`url` of the otlp collector to push the metrics to (https for tls; defaults to the one of otel environment variables, or to localhost)",
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsOTLPHeaders,
+			EnvVars:     []string{envPrefix + "METRICS_OTLP_HEADERS"},
+			Name:        "metrics-otlp-header",
+			Usage:       "extra headers of the otlp push requests in the format `header=value`",
+		},
+
+		&cli.DurationFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.OTLPInterval,
+			EnvVars:     []string{envPrefix + "METRICS_OTLP_INTERVAL"},
+			Name:        "metrics-otlp-interval",
+			Usage:       "`interval` at which the metrics should be pushed to the otlp collector",
+			Value:       15 * time.Second,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.PeerUpIntervals,
+			EnvVars:     []string{envPrefix + "METRICS_PEER_UP_INTERVALS"},
+			Name:        "metrics-peer-up-intervals",
+			Usage:       "`count` of the probing intervals within which the peer must return a probe to be reported as up",
+			Value:       3,
+		},
+
+		&cli.Float64SliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsQuantiles,
+			EnvVars:     []string{envPrefix + "METRICS_QUANTILES"},
+			Name:        "metrics-quantile",
+			Usage:       "`quantile` of the latencies to estimate over the sliding windows",
+			Value:       cli.NewFloat64Slice(0.5, 0.9, 0.99, 0.999),
+		},
+
+		&cli.Float64Flag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.QuantileAccuracy,
+			EnvVars:     []string{envPrefix + "METRICS_QUANTILE_ACCURACY"},
+			Name:        "metrics-quantile-accuracy",
+			Usage:       "relative `accuracy` of the latency quantiles estimates",
+			Value:       0.01,
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryMetrics,
+			Destination: metricsQuantileWindows,
+			EnvVars:     []string{envPrefix + "METRICS_QUANTILE_WINDOWS"},
+			Name:        "metrics-quantile-window",
+			Usage:       "`duration` of the sliding window to estimate the latency quantiles over (none by default)",
+		},
+
+		&cli.StringFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.StatsDAddress,
+			EnvVars:     []string{envPrefix + "METRICS_STATSD_ADDRESS"},
+			Name:        "metrics-statsd-address",
+			Usage:       "`host:port` of the statsd agent to emit the probe counters and raw latencies to (dogstatsd format)",
+		},
+
+		&cli.StringFlag{
+			Category:    categoryMetrics,
+			Destination: &cfg.Metrics.StatsDPrefix,
+			EnvVars:     []string{envPrefix + "METRICS_STATSD_PREFIX"},
+			Name:        "metrics-statsd-prefix",
+			Usage:       "`prefix` of the metrics names emitted to the statsd agent",
+			Value:       "latency_monitor.",
+		},
 	}
 
 	transponderFlags := []cli.Flag{
+		&cli.IntFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.BatchSize,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_BATCH_SIZE"},
+			Name:        "transponder-batch-size",
+			Usage:       "max `count` of datagrams to read or write with a single syscall",
+			Value:       32,
+		},
+
+		&cli.DurationFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.ConnectTimeout,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_CONNECT_TIMEOUT"},
+			Name:        "transponder-connect-timeout",
+			Usage:       "`timeout` for connecting to (and requesting from) the peers of connection-oriented kinds (tcp, tcp-stream, http, quic)",
+			Value:       5 * time.Second,
+		},
+
 		&cli.DurationFlag{
 			Category:    categoryTransponder,
 			Destination: &cfg.Transponder.Interval,
@@ -79,13 +296,22 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			Value:       time.Minute,
 		},
 
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Category:    categoryTransponder,
-			Destination: &cfg.Transponder.ListenAddress,
+			Destination: transponderListenAddresses,
 			EnvVars:     []string{envPrefix + "TRANSPONDER_LISTEN_ADDRESS"},
 			Name:        "transponder-listen-address",
-			Usage:       "`host:port` for the transponder to listen on",
-			Value:       "0.0.0.0:32123",
+			Usage:       "`host:port` for the transponder to listen on (the first one is also used to send the probes)",
+			Value:       cli.NewStringSlice("0.0.0.0:32123"),
+		},
+
+		&cli.StringFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.Mode,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_MODE"},
+			Name:        "transponder-mode",
+			Usage:       fmt.Sprintf("`mode` to run the transponder in (%s)", strings.Join(transponderModes, ", ")),
+			Value:       config.ModeBoth,
 		},
 
 		&cli.StringSliceFlag{
@@ -93,7 +319,141 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			Destination: transponderPeers,
 			EnvVars:     []string{envPrefix + "TRANSPONDER_PEERS"},
 			Name:        "transponder-peer",
-			Usage:       "`name=host:port` of the transponder peer to measure the latency against",
+			Usage:       "`name=[kind://]host:port[;option=value]` of the transponder peer to measure the latency against (kinds: udp, http(s), icmp, quic, tcp, tcp-stream, twamp; options: buckets, device, dscp, source, and method, body, header for http)",
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryTransponder,
+			Destination: transponderQUICListenAddresses,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_QUIC_LISTEN_ADDRESS"},
+			Name:        "transponder-quic-listen-address",
+			Usage:       "`host:port` for the transponder to accept quic connections on",
+		},
+
+		&cli.IntFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.ReplyWorkers,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_REPLY_WORKERS"},
+			Name:        "transponder-reply-workers",
+			Usage:       "`count` of workers (per listener socket) sending the responses to the probes",
+			Value:       4,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.Sockets,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_SOCKETS"},
+			Name:        "transponder-sockets",
+			Usage:       "`count` of sockets (with SO_REUSEPORT) to open per listen address, each with its own reader pinned to a cpu",
+			Value:       1,
+		},
+
+		&cli.DurationFlag{
+			Category:    categoryTransponder,
+			Destination: &cfg.Transponder.StreamIdleTimeout,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_STREAM_IDLE_TIMEOUT"},
+			Name:        "transponder-stream-idle-timeout",
+			Usage:       "`timeout` after which the idle accepted tcp streams are closed (must exceed the peers' probing interval)",
+			Value:       5 * time.Minute,
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryTransponder,
+			Destination: transponderStreamListenAddresses,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_STREAM_LISTEN_ADDRESS"},
+			Name:        "transponder-stream-listen-address",
+			Usage:       "`host:port` for the transponder to accept persistent tcp streams on",
+		},
+
+		&cli.StringSliceFlag{
+			Category:    categoryTransponder,
+			Destination: transponderTWAMPListenAddresses,
+			EnvVars:     []string{envPrefix + "TRANSPONDER_TWAMP_LISTEN_ADDRESS"},
+			Name:        "transponder-twamp-listen-address",
+			Usage:       "`host:port` for the twamp-light session-reflector to listen on (e.g. 0.0.0.0:862)",
+		},
+	}
+
+	pathDiscoveryFlags := []cli.Flag{
+		&cli.DurationFlag{
+			Category:    categoryPathDiscovery,
+			Destination: &cfg.PathDiscovery.Interval,
+			EnvVars:     []string{envPrefix + "PATH_DISCOVERY_INTERVAL"},
+			Name:        "path-discovery-interval",
+			Usage:       "`interval` at which to discover the paths towards the peers (0 means on demand only)",
+			Value:       0,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryPathDiscovery,
+			Destination: &cfg.PathDiscovery.MaxHops,
+			EnvVars:     []string{envPrefix + "PATH_DISCOVERY_MAX_HOPS"},
+			Name:        "path-discovery-max-hops",
+			Usage:       "max `count` of hops to discover",
+			Value:       30,
+		},
+
+		&cli.DurationFlag{
+			Category:    categoryPathDiscovery,
+			Destination: &cfg.PathDiscovery.Timeout,
+			EnvVars:     []string{envPrefix + "PATH_DISCOVERY_TIMEOUT"},
+			Name:        "path-discovery-timeout",
+			Usage:       "`timeout` to wait for the hops to reply",
+			Value:       3 * time.Second,
+		},
+	}
+
+	responderFlags := []cli.Flag{
+		&cli.StringSliceFlag{
+			Category:    categoryResponder,
+			Destination: responderAllowedNetworks,
+			EnvVars:     []string{envPrefix + "RESPONDER_ALLOWED_NETWORKS"},
+			Name:        "responder-allow-network",
+			Usage:       "`cidr` of the network to accept the probes from (if none are set, any network is allowed)",
+		},
+
+		&cli.BoolFlag{
+			Category:    categoryResponder,
+			Destination: &cfg.Responder.AllowPeersOnly,
+			EnvVars:     []string{envPrefix + "RESPONDER_ALLOW_PEERS_ONLY"},
+			Name:        "responder-allow-peers-only",
+			Usage:       "only accept the probes from the addresses of the configured transponder peers",
+		},
+
+		&cli.Float64Flag{
+			Category:    categoryResponder,
+			Destination: &cfg.Responder.RateLimitGlobal,
+			EnvVars:     []string{envPrefix + "RESPONDER_RATE_LIMIT_GLOBAL"},
+			Name:        "responder-rate-limit-global",
+			Usage:       "max `rate` (per second) of responses to the probes in total (0 means unlimited)",
+			Value:       0,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryResponder,
+			Destination: &cfg.Responder.RateLimitGlobalBurst,
+			EnvVars:     []string{envPrefix + "RESPONDER_RATE_LIMIT_GLOBAL_BURST"},
+			Name:        "responder-rate-limit-global-burst",
+			Usage:       "max `count` of responses to the probes in total to allow in a burst",
+			Value:       1000,
+		},
+
+		&cli.Float64Flag{
+			Category:    categoryResponder,
+			Destination: &cfg.Responder.RateLimitPerSource,
+			EnvVars:     []string{envPrefix + "RESPONDER_RATE_LIMIT_PER_SOURCE"},
+			Name:        "responder-rate-limit-per-source",
+			Usage:       "max `rate` (per second) of responses to the probes per source ip (0 means unlimited)",
+			Value:       0,
+		},
+
+		&cli.IntFlag{
+			Category:    categoryResponder,
+			Destination: &cfg.Responder.RateLimitPerSourceBurst,
+			EnvVars:     []string{envPrefix + "RESPONDER_RATE_LIMIT_PER_SOURCE_BURST"},
+			Name:        "responder-rate-limit-per-source-burst",
+			Usage:       "max `count` of responses to the probes per source ip to allow in a burst",
+			Value:       100,
 		},
 	}
 
@@ -111,6 +471,8 @@ func CommandServe(cfg *config.Config) *cli.Command {
 	flags := slices.Concat(
 		serverFlags,
 		metricsFlags,
+		pathDiscoveryFlags,
+		responderFlags,
 		transponderFlags,
 	)
 
@@ -128,6 +490,185 @@ func CommandServe(cfg *config.Config) *cli.Command {
 				)
 			}
 
+			// allowed locations
+			cfg.Metrics.AllowedLocations = metricsAllowedLocations.Value()
+			for _, location := range cfg.Metrics.AllowedLocations {
+				if len([]byte(location)) > types.LocationSize() {
+					return fmt.Errorf("byte representation of allowed location must not exceed %d bytes: %s",
+						types.LocationSize(), location,
+					)
+				}
+			}
+			if cfg.Metrics.MaxLocations < 0 {
+				return fmt.Errorf("max locations count must not be negative: %d",
+					cfg.Metrics.MaxLocations,
+				)
+			}
+
+			// latency histograms
+			if !slices.Contains(latencyHistograms, cfg.Metrics.LatencyHistogram) {
+				return fmt.Errorf("invalid latency histogram kind: %s",
+					cfg.Metrics.LatencyHistogram,
+				)
+			}
+			if cfg.Metrics.LatencyHistogramMaxScale < -10 || cfg.Metrics.LatencyHistogramMaxScale > 20 {
+				return fmt.Errorf("latency histogram max scale must be within -10..20: %d",
+					cfg.Metrics.LatencyHistogramMaxScale,
+				)
+			}
+			if cfg.Metrics.LatencyHistogramMaxSize < 2 {
+				return fmt.Errorf("latency histogram max size must be at least 2: %d",
+					cfg.Metrics.LatencyHistogramMaxSize,
+				)
+			}
+
+			// latency buckets
+			if l := metricsLatencyBuckets.Value(); len(l) > 0 {
+				buckets, err := parseBuckets(l)
+				if err != nil {
+					return err
+				}
+				cfg.Metrics.LatencyBuckets = buckets
+			}
+			bp := metricsLatencyBucketProfiles.Value()
+			profiles := make(map[string][]float64, len(bp))
+			for _, strProfile := range bp {
+				name, strBuckets, found := strings.Cut(strProfile, "=")
+				if !found || name == "" {
+					return fmt.Errorf("invalid latency bucket profile format: %s", strProfile)
+				}
+				buckets, err := parseBuckets(strings.Fields(strBuckets))
+				if err != nil {
+					return fmt.Errorf("%w: %s", err, name)
+				}
+				profiles[name] = buckets
+			}
+			cfg.Metrics.LatencyBucketProfiles = profiles
+
+			// latency ewma
+			if cfg.Metrics.LatencyEWMAAlpha <= 0 || cfg.Metrics.LatencyEWMAAlpha > 1 {
+				return fmt.Errorf("latency ewma alpha must be within 0..1 (exclusive of 0): %v",
+					cfg.Metrics.LatencyEWMAAlpha,
+				)
+			}
+
+			// peer up
+			if cfg.Metrics.PeerUpIntervals < 1 {
+				return fmt.Errorf("peer up intervals count must be positive: %d",
+					cfg.Metrics.PeerUpIntervals,
+				)
+			}
+
+			// latency quantiles
+			cfg.Metrics.Quantiles = metricsQuantiles.Value()
+			for _, quantile := range cfg.Metrics.Quantiles {
+				if quantile < 0 || quantile > 1 {
+					return fmt.Errorf("latency quantile must be within 0..1: %v",
+						quantile,
+					)
+				}
+			}
+			if cfg.Metrics.QuantileAccuracy <= 0 || cfg.Metrics.QuantileAccuracy >= 1 {
+				return fmt.Errorf("latency quantile accuracy must be within 0..1 (exclusive): %v",
+					cfg.Metrics.QuantileAccuracy,
+				)
+			}
+			qw := metricsQuantileWindows.Value()
+			windows := make([]time.Duration, 0, len(qw))
+			for _, strWindow := range qw {
+				window, err := time.ParseDuration(strWindow)
+				if err != nil {
+					return fmt.Errorf("invalid latency quantile window: %w", err)
+				}
+				if window <= 0 {
+					return fmt.Errorf("latency quantile window must be positive: %s",
+						strWindow,
+					)
+				}
+				windows = append(windows, window)
+			}
+			cfg.Metrics.QuantileWindows = windows
+
+			// metrics exporters
+			cfg.Metrics.Exporters = metricsExporterNames.Value()
+			for _, exporter := range cfg.Metrics.Exporters {
+				if !slices.Contains(metricsExporters, exporter) {
+					return fmt.Errorf("invalid metrics exporter: %s",
+						exporter,
+					)
+				}
+			}
+			if cfg.Metrics.Pushes() {
+				if cfg.Metrics.OTLPEndpoint != "" {
+					u, err := url.Parse(cfg.Metrics.OTLPEndpoint)
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return fmt.Errorf("invalid metrics otlp endpoint: %s",
+							cfg.Metrics.OTLPEndpoint,
+						)
+					}
+				}
+				if cfg.Metrics.OTLPInterval <= 0 {
+					return fmt.Errorf("metrics otlp interval must be positive: %s",
+						cfg.Metrics.OTLPInterval,
+					)
+				}
+			}
+
+			// metrics otlp headers
+			h := metricsOTLPHeaders.Value()
+			headers := make(map[string]string, len(h))
+			for _, strHeader := range h {
+				parts := strings.SplitN(strHeader, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid otlp header format: %s", strHeader)
+				}
+				headers[parts[0]] = parts[1]
+			}
+			cfg.Metrics.OTLPHeaders = headers
+
+			// path discovery
+			if cfg.PathDiscovery.MaxHops < 1 || cfg.PathDiscovery.MaxHops > 255 {
+				return fmt.Errorf("path discovery max hops must be within 1..255: %d",
+					cfg.PathDiscovery.MaxHops,
+				)
+			}
+			if cfg.PathDiscovery.Timeout <= 0 {
+				return fmt.Errorf("path discovery timeout must be positive: %s",
+					cfg.PathDiscovery.Timeout,
+				)
+			}
+
+			// transponder sockets
+			if cfg.Transponder.BatchSize < 1 {
+				return fmt.Errorf("transponder batch size must be positive: %d",
+					cfg.Transponder.BatchSize,
+				)
+			}
+			if cfg.Transponder.ReplyWorkers < 1 {
+				return fmt.Errorf("transponder reply workers count must be positive: %d",
+					cfg.Transponder.ReplyWorkers,
+				)
+			}
+			if cfg.Transponder.Sockets < 1 {
+				return fmt.Errorf("transponder sockets count must be positive: %d",
+					cfg.Transponder.Sockets,
+				)
+			}
+
+			// transponder connect timeout
+			if cfg.Transponder.ConnectTimeout <= 0 {
+				return fmt.Errorf("transponder connect timeout must be positive: %s",
+					cfg.Transponder.ConnectTimeout,
+				)
+			}
+
+			// transponder stream idle timeout
+			if cfg.Transponder.StreamIdleTimeout <= 0 {
+				return fmt.Errorf("transponder stream idle timeout must be positive: %s",
+					cfg.Transponder.StreamIdleTimeout,
+				)
+			}
+
 			// metrics labels
 			l := metricsLabels.Value()
 			labels := make(map[string]string, len(l))
@@ -140,6 +681,38 @@ func CommandServe(cfg *config.Config) *cli.Command {
 			}
 			cfg.Metrics.Labels = labels
 
+			// responder allowed networks
+			n := responderAllowedNetworks.Value()
+			networks := make([]*net.IPNet, 0, len(n))
+			for _, strNetwork := range n {
+				if !strings.Contains(strNetwork, "/") { // single ip
+					if ip := net.ParseIP(strNetwork); ip != nil && ip.To4() != nil {
+						strNetwork += "/32"
+					} else {
+						strNetwork += "/128"
+					}
+				}
+				_, network, err := net.ParseCIDR(strNetwork)
+				if err != nil {
+					return fmt.Errorf("invalid network: %w", err)
+				}
+				networks = append(networks, network)
+			}
+			cfg.Responder.AllowedNetworks = networks
+
+			// transponder mode
+			if !slices.Contains(transponderModes, cfg.Transponder.Mode) {
+				return fmt.Errorf("invalid transponder mode: %s",
+					cfg.Transponder.Mode,
+				)
+			}
+
+			// transponder listen addresses
+			cfg.Transponder.ListenAddresses = transponderListenAddresses.Value()
+			cfg.Transponder.QUICListenAddresses = transponderQUICListenAddresses.Value()
+			cfg.Transponder.StreamListenAddresses = transponderStreamListenAddresses.Value()
+			cfg.Transponder.TWAMPListenAddresses = transponderTWAMPListenAddresses.Value()
+
 			// transponder peers
 			p := transponderPeers.Value()
 			peers := make([]types.Peer, 0, len(p))
@@ -148,6 +721,11 @@ func CommandServe(cfg *config.Config) *cli.Command {
 				if err != nil {
 					return err
 				}
+				if profile := peer.BucketProfile(); profile != "" && profiles[profile] == nil {
+					return fmt.Errorf("unknown latency bucket profile of peer %s: %s",
+						peer.Name(), profile,
+					)
+				}
 				peers = append(peers, peer)
 			}
 			cfg.Transponder.Peers = peers
@@ -164,3 +742,24 @@ func CommandServe(cfg *config.Config) *cli.Command {
 		},
 	}
 }
+
+// parseBuckets parses the boundaries of latency histogram buckets.
+func parseBuckets(strBuckets []string) ([]float64, error) {
+	if len(strBuckets) == 0 {
+		return nil, fmt.Errorf("no latency buckets")
+	}
+	buckets := make([]float64, 0, len(strBuckets))
+	for _, strBucket := range strBuckets {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(strBucket), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency bucket: %w", err)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("latency buckets must be increasing: %s",
+				strings.Join(strBuckets, ","),
+			)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
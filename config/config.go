@@ -1,8 +1,10 @@
 package config
 
 type Config struct {
-	Log         Log         `yaml:"log"`
-	Metrics     Metrics     `yaml:"metrics"`
-	Transponder Transponder `yaml:"transponder"`
-	Server      Server      `yaml:"server"`
+	Log           Log           `yaml:"log"`
+	Metrics       Metrics       `yaml:"metrics"`
+	PathDiscovery PathDiscovery `yaml:"path_discovery"`
+	Responder     Responder     `yaml:"responder"`
+	Transponder   Transponder   `yaml:"transponder"`
+	Server        Server        `yaml:"server"`
 }
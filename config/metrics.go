@@ -1,13 +1,60 @@
 package config
 
+import "time"
+
 type Metrics struct {
-	ListenAddress string `yaml:"metrics_listen_address"`
+	Exemplars     bool     `yaml:"metrics_exemplars"`
+	Exporters     []string `yaml:"metrics_exporters"`
+	ListenAddress string   `yaml:"metrics_listen_address"`
 
 	Labels   map[string]string
 	Location string
 
-	LatencyBucketsCount int `yaml:"metrics_latency_buckets_count"`
-	MaxLatencyUs        int `yaml:"metrics_max_latency_us"`
+	AllowedLocations []string `yaml:"metrics_allowed_locations"`
+	MaxLocations     int      `yaml:"metrics_max_locations"`
+
+	LatencyBucketProfiles    map[string][]float64 `yaml:"metrics_latency_bucket_profiles"`
+	LatencyBuckets           []float64            `yaml:"metrics_latency_buckets"`
+	LatencyBucketsCount      int                  `yaml:"metrics_latency_buckets_count"`
+	LatencyEWMAAlpha         float64              `yaml:"metrics_latency_ewma_alpha"`
+	LatencyHistogram         string               `yaml:"metrics_latency_histogram"`
+	LatencyHistogramMaxScale int                  `yaml:"metrics_latency_histogram_max_scale"`
+	LatencyHistogramMaxSize  int                  `yaml:"metrics_latency_histogram_max_size"`
+	MaxLatencyUs             int                  `yaml:"metrics_max_latency_us"`
+
+	OTLPEndpoint string            `yaml:"metrics_otlp_endpoint"`
+	OTLPHeaders  map[string]string `yaml:"metrics_otlp_headers"`
+	OTLPInterval time.Duration     `yaml:"metrics_otlp_interval"`
+
+	PeerUpIntervals int `yaml:"metrics_peer_up_intervals"`
+
+	QuantileAccuracy float64         `yaml:"metrics_quantile_accuracy"`
+	QuantileWindows  []time.Duration `yaml:"metrics_quantile_windows"`
+	Quantiles        []float64       `yaml:"metrics_quantiles"`
+
+	StatsDAddress string `yaml:"metrics_statsd_address"`
+	StatsDPrefix  string `yaml:"metrics_statsd_prefix"`
 
 	Version string `yaml:"metrics_version"`
 }
+
+const (
+	ExporterOTLPGRPC   = "otlp-grpc"
+	ExporterOTLPHTTP   = "otlp-http"
+	ExporterPrometheus = "prometheus"
+)
+
+const (
+	HistogramExplicit    = "explicit"    // fixed log-spaced buckets
+	HistogramExponential = "exponential" // otel exponential (prometheus native)
+)
+
+// Pushes tells whether any of the exporters pushes the metrics via otlp.
+func (m Metrics) Pushes() bool {
+	for _, exporter := range m.Exporters {
+		if exporter == ExporterOTLPGRPC || exporter == ExporterOTLPHTTP {
+			return true
+		}
+	}
+	return false
+}
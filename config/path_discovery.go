@@ -0,0 +1,11 @@
+package config
+
+import (
+	"time"
+)
+
+type PathDiscovery struct {
+	Interval time.Duration `yaml:"path_discovery_interval"`
+	MaxHops  int           `yaml:"path_discovery_max_hops"`
+	Timeout  time.Duration `yaml:"path_discovery_timeout"`
+}
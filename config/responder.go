@@ -0,0 +1,15 @@
+package config
+
+import (
+	"net"
+)
+
+type Responder struct {
+	AllowedNetworks []*net.IPNet `yaml:"responder_allowed_networks"`
+	AllowPeersOnly  bool         `yaml:"responder_allow_peers_only"`
+
+	RateLimitGlobal         float64 `yaml:"responder_rate_limit_global"`
+	RateLimitGlobalBurst    int     `yaml:"responder_rate_limit_global_burst"`
+	RateLimitPerSource      float64 `yaml:"responder_rate_limit_per_source"`
+	RateLimitPerSourceBurst int     `yaml:"responder_rate_limit_per_source_burst"`
+}
@@ -7,7 +7,32 @@ import (
 )
 
 type Transponder struct {
-	Interval      time.Duration `yaml:"transponder_interval"`
-	ListenAddress string        `yaml:"transponder_listen_address"`
-	Peers         []types.Peer  `yaml:"transponder_peers"`
+	BatchSize             int           `yaml:"transponder_batch_size"`
+	ConnectTimeout        time.Duration `yaml:"transponder_connect_timeout"`
+	Interval              time.Duration `yaml:"transponder_interval"`
+	ListenAddresses       []string      `yaml:"transponder_listen_addresses"`
+	Mode                  string        `yaml:"transponder_mode"`
+	Peers                 []types.Peer  `yaml:"transponder_peers"`
+	QUICListenAddresses   []string      `yaml:"transponder_quic_listen_addresses"`
+	ReplyWorkers          int           `yaml:"transponder_reply_workers"`
+	Sockets               int           `yaml:"transponder_sockets"`
+	StreamIdleTimeout     time.Duration `yaml:"transponder_stream_idle_timeout"`
+	StreamListenAddresses []string      `yaml:"transponder_stream_listen_addresses"`
+	TWAMPListenAddresses  []string      `yaml:"transponder_twamp_listen_addresses"`
+}
+
+const (
+	ModeBoth      = "both"
+	ModeInitiator = "initiator"
+	ModeResponder = "responder"
+)
+
+// Initiates tells whether the transponder sends the probes to its peers.
+func (t Transponder) Initiates() bool {
+	return t.Mode == ModeBoth || t.Mode == ModeInitiator
+}
+
+// Responds tells whether the transponder replies to the others' probes.
+func (t Transponder) Responds() bool {
+	return t.Mode == ModeBoth || t.Mode == ModeResponder
 }
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+)
+
+// the keys are short because prometheus limits the exemplar labels to 128
+// runes, and trace_id and span_id take half of that already
+const (
+	exemplarKeySequence     = "seq"
+	exemplarKeySrcTimestamp = "src_ts"
+	exemplarKeyDstTimestamp = "dst_ts"
+)
+
+type exemplarContextKey struct{}
+
+// ContextWithExemplar marks the measurements recorded with the context as the
+// candidates for the exemplars.
+func ContextWithExemplar(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exemplarContextKey{}, true)
+}
+
+// ExemplarAttributes returns the attributes that link the measurement to the
+// probe.  They are dropped from the metrics themselves, and only end up in
+// their exemplars.
+func ExemplarAttributes(sequence uint64, srcTimestamp, dstTimestamp time.Time) []otelattr.KeyValue {
+	return []otelattr.KeyValue{
+		otelattr.String(exemplarKeySequence, strconv.FormatUint(sequence, 10)),
+		otelattr.Int64(exemplarKeySrcTimestamp, srcTimestamp.UnixMicro()),
+		otelattr.Int64(exemplarKeyDstTimestamp, dstTimestamp.UnixMicro()),
+	}
+}
+
+// exemplarFilter only offers the marked measurements to the exemplars (if
+// they are enabled at all).
+func exemplarFilter(cfg *config.Metrics) exemplar.Filter {
+	if !cfg.Exemplars {
+		return exemplar.AlwaysOffFilter
+	}
+	return func(ctx context.Context) bool {
+		return ctx.Value(exemplarContextKey{}) != nil
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/flashbots/latency-monitor/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+var (
+	ErrUnknownExporter = errors.New("unknown metrics exporter")
+)
+
+const (
+	otlpHTTPPath = "/v1/metrics"
+)
+
+// newReader returns the reader that exports the metrics in a way the exporter
+// does (see config.ExporterXXX).
+func newReader(ctx context.Context, exporter string, cfg *config.Metrics) (metric.Reader, error) {
+	switch exporter {
+	case config.ExporterPrometheus:
+		return prometheus.New(
+			prometheus.WithNamespace(prometheusNamespace),
+			prometheus.WithoutScopeInfo(),
+		)
+
+	case config.ExporterOTLPGRPC:
+		options := []otlpmetricgrpc.Option{}
+		if cfg.OTLPEndpoint != "" {
+			options = append(options, otlpmetricgrpc.WithEndpointURL(cfg.OTLPEndpoint))
+		}
+		if len(cfg.OTLPHeaders) > 0 {
+			options = append(options, otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders))
+		}
+		exp, err := otlpmetricgrpc.New(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		return metric.NewPeriodicReader(exp, metric.WithInterval(cfg.OTLPInterval)), nil
+
+	case config.ExporterOTLPHTTP:
+		options := []otlpmetrichttp.Option{}
+		if cfg.OTLPEndpoint != "" {
+			u, err := url.Parse(cfg.OTLPEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			if u.Path == "" || u.Path == "/" { // collector's default
+				u.Path = otlpHTTPPath
+			}
+			options = append(options, otlpmetrichttp.WithEndpointURL(u.String()))
+		}
+		if len(cfg.OTLPHeaders) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(cfg.OTLPHeaders))
+		}
+		exp, err := otlpmetrichttp.New(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		return metric.NewPeriodicReader(exp, metric.WithInterval(cfg.OTLPInterval)), nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s",
+			ErrUnknownExporter, exporter,
+		)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/stretchr/testify/require"
+	collector "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpCollector is the stand-in for otlp collector that remembers the names
+// of the pushed metrics along with the value of the test header.
+type otlpCollector struct {
+	collector.UnimplementedMetricsServiceServer
+
+	mx      sync.Mutex
+	names   map[string]bool
+	headers []string
+}
+
+func newOTLPCollector() *otlpCollector {
+	return &otlpCollector{
+		names: make(map[string]bool),
+	}
+}
+
+func (c *otlpCollector) collect(req *collector.ExportMetricsServiceRequest, header string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.headers = append(c.headers, header)
+	for _, rm := range req.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				c.names[m.GetName()] = true
+			}
+		}
+	}
+}
+
+func (c *otlpCollector) Export(ctx context.Context, req *collector.ExportMetricsServiceRequest) (*collector.ExportMetricsServiceResponse, error) {
+	header := ""
+	if md, ok := grpcmetadata.FromIncomingContext(ctx); ok && len(md.Get("x-test")) > 0 {
+		header = md.Get("x-test")[0]
+	}
+	c.collect(req, header)
+	return &collector.ExportMetricsServiceResponse{}, nil
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &collector.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.collect(req, r.Header.Get("x-test"))
+
+	res, _ := proto.Marshal(&collector.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(res)
+}
+
+func TestOTLPExporters(t *testing.T) {
+	for _, exporter := range []string{config.ExporterOTLPGRPC, config.ExporterOTLPHTTP} {
+		t.Run(exporter, func(t *testing.T) {
+			c := newOTLPCollector()
+
+			var endpoint string
+			switch exporter {
+			case config.ExporterOTLPGRPC:
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				srv := grpc.NewServer()
+				collector.RegisterMetricsServiceServer(srv, c)
+				go func() {
+					_ = srv.Serve(l)
+				}()
+				t.Cleanup(srv.Stop)
+				endpoint = "http://" + l.Addr().String()
+			case config.ExporterOTLPHTTP:
+				srv := httptest.NewServer(c)
+				t.Cleanup(srv.Close)
+				endpoint = srv.URL
+			}
+
+			require.NoError(t, metrics.Setup(context.Background(), &config.Metrics{
+				Exporters:           []string{exporter},
+				LatencyBucketsCount: 33,
+				MaxLatencyUs:        1000000,
+				OTLPEndpoint:        endpoint,
+				OTLPHeaders:         map[string]string{"x-test": exporter},
+			}))
+
+			metrics.CountProbeSent.Add(context.Background(), 1)
+			metrics.HistogramLatencyRoundTrip.Record(context.Background(), 42)
+
+			require.NoError(t, metrics.Shutdown(context.Background())) // flushes
+
+			c.mx.Lock()
+			defer c.mx.Unlock()
+			require.NotEmpty(t, c.headers)
+			require.Equal(t, exporter, c.headers[0])
+			require.True(t, c.names["probe_sent_count"])
+			require.True(t, c.names["round_trip_latency"])
+		})
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	err := metrics.Setup(context.Background(), &config.Metrics{
+		Exporters: []string{"carrier-pigeon"},
+	})
+	require.ErrorIs(t, err, metrics.ErrUnknownExporter)
+}
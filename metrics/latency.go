@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/flashbots/latency-monitor/config"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+// LatencyProfile is the set of latency histograms that share the same bucket
+// boundaries.
+type LatencyProfile struct {
+	ForwardTrip otelapi.Float64Histogram
+	ReturnTrip  otelapi.Float64Histogram
+	RoundTrip   otelapi.Float64Histogram
+}
+
+var (
+	latencyProfiles map[string]*LatencyProfile
+)
+
+// Latency returns the latency histograms of the bucket profile (the default
+// ones for the empty or unknown profile).
+func Latency(profile string) *LatencyProfile {
+	if latency, ok := latencyProfiles[profile]; ok {
+		return latency
+	}
+	return &LatencyProfile{
+		ForwardTrip: HistogramLatencyForwardTrip,
+		ReturnTrip:  HistogramLatencyReturnTrip,
+		RoundTrip:   HistogramLatencyRoundTrip,
+	}
+}
+
+func setupHistogramsLatency(_ context.Context, cfg *config.Metrics) error {
+	latency, err := newLatencyProfile(meter, latencyBoundariesUs)
+	if err != nil {
+		return err
+	}
+	HistogramLatencyForwardTrip = latency.ForwardTrip
+	HistogramLatencyReturnTrip = latency.ReturnTrip
+	HistogramLatencyRoundTrip = latency.RoundTrip
+
+	// the same histograms can not have different boundaries within the same
+	// meter, hence the meter per profile
+	latencyProfiles = make(map[string]*LatencyProfile, len(cfg.LatencyBucketProfiles))
+	for name, boundaries := range cfg.LatencyBucketProfiles {
+		latency, err := newLatencyProfile(
+			provider.Meter(metricsNamespace+"/"+name),
+			otelapi.WithExplicitBucketBoundaries(boundaries...),
+		)
+		if err != nil {
+			return err
+		}
+		latencyProfiles[name] = latency
+	}
+
+	return nil
+}
+
+func setupHistogramLatencyInbound(_ context.Context, _ *config.Metrics) error {
+	histogram, err := meter.Float64Histogram(
+		"inbound_forward_trip_latency",
+		otelapi.WithDescription("statistics on the latency of the others' probes' forward-trip (as observed by us)"),
+		otelapi.WithUnit(unitMicroseconds),
+		latencyBoundariesUs,
+	)
+	HistogramLatencyInboundForwardTrip = histogram
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func newLatencyProfile(m otelapi.Meter, boundaries otelapi.HistogramOption) (*LatencyProfile, error) {
+	forwardTrip, err := m.Float64Histogram(
+		"forward_trip_latency",
+		otelapi.WithDescription("statistics on the latency of probes' forward-trip"),
+		otelapi.WithUnit(unitMicroseconds),
+		boundaries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	returnTrip, err := m.Float64Histogram(
+		"return_trip_latency",
+		otelapi.WithDescription("statistics on the latency of probes' return-trip"),
+		otelapi.WithUnit(unitMicroseconds),
+		boundaries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	roundTrip, err := m.Float64Histogram(
+		"round_trip_latency",
+		otelapi.WithDescription("statistics on the latency of probes' round-trip"),
+		otelapi.WithUnit(unitMicroseconds),
+		boundaries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LatencyProfile{
+		ForwardTrip: forwardTrip,
+		ReturnTrip:  returnTrip,
+		RoundTrip:   roundTrip,
+	}, nil
+}
+
+func setupGaugesLatency(_ context.Context, _ *config.Metrics) error {
+	for _, g := range []struct {
+		gauge       *otelapi.Float64Gauge
+		name        string
+		description string
+	}{
+		{&GaugeLastForwardTripLatency, "last_forward_trip_latency", "latency of the latest probe's forward-trip"},
+		{&GaugeLastReturnTripLatency, "last_return_trip_latency", "latency of the latest probe's return-trip"},
+		{&GaugeLastRoundTripLatency, "last_round_trip_latency", "latency of the latest probe's round-trip"},
+		{&GaugeSmoothedForwardTripLatency, "smoothed_forward_trip_latency", "exponentially weighted moving average of the latency of probes' forward-trip"},
+		{&GaugeSmoothedReturnTripLatency, "smoothed_return_trip_latency", "exponentially weighted moving average of the latency of probes' return-trip"},
+		{&GaugeSmoothedRoundTripLatency, "smoothed_round_trip_latency", "exponentially weighted moving average of the latency of probes' round-trip"},
+	} {
+		gauge, err := meter.Float64Gauge(
+			g.name,
+			otelapi.WithDescription(g.description),
+			otelapi.WithUnit(unitMicroseconds),
+		)
+		*g.gauge = gauge
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,29 +5,64 @@ import (
 	"math"
 
 	"github.com/flashbots/latency-monitor/config"
-	"go.opentelemetry.io/otel/exporters/prometheus"
+	otelattr "go.opentelemetry.io/otel/attribute"
 	otelapi "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 )
 
 const (
-	metricsNamespace = "latency-monitor"
+	metricsNamespace    = "latency-monitor"
+	prometheusNamespace = "latency_monitor" // utf-8 names would be exposed as-is
+
+	unitMicroseconds = "us"
 )
 
 var (
 	meter               otelapi.Meter
+	provider            *metric.MeterProvider
 	latencyBoundariesUs otelapi.HistogramOption
 
-	CountProbeReturned otelapi.Int64Counter
-	CountProbeSent     otelapi.Int64Counter
+	CountProbeReceived  otelapi.Int64Counter
+	CountProbeResponded otelapi.Int64Counter
+	CountProbeReturned  otelapi.Int64Counter
+	CountProbeSent      otelapi.Int64Counter
 
+	CounterDSCPRemarked         otelapi.Int64Counter
 	CounterFailedProbeRespond   otelapi.Int64Counter
 	CounterFailedProbeSend      otelapi.Int64Counter
 	CounterInvalidProbeReceived otelapi.Int64Counter
+	CounterLabelOverflow        otelapi.Int64Counter
+	CounterPathChange           otelapi.Int64Counter
+	CounterPeerReconnect        otelapi.Int64Counter
+	CounterProbeRejected        otelapi.Int64Counter
+	CounterProbeReplyThrottled  otelapi.Int64Counter
+
+	GaugeLastForwardTripLatency     otelapi.Float64Gauge
+	GaugeLastReturnTripLatency      otelapi.Float64Gauge
+	GaugeLastRoundTripLatency       otelapi.Float64Gauge
+	GaugeSmoothedForwardTripLatency otelapi.Float64Gauge
+	GaugeSmoothedReturnTripLatency  otelapi.Float64Gauge
+	GaugeSmoothedRoundTripLatency   otelapi.Float64Gauge
+
+	GaugeLatencyQuantile otelapi.Float64ObservableGauge
+	GaugeMode            otelapi.Int64Gauge
+	GaugePathHopCount    otelapi.Int64Gauge
+	GaugePeerInfo        otelapi.Int64ObservableGauge
+	GaugePeerLastSeen    otelapi.Float64ObservableGauge
+	GaugePeerUp          otelapi.Int64ObservableGauge
+	GaugeQUICSmoothedRTT otelapi.Float64Gauge
 
-	HistogramLatencyForwardTrip otelapi.Float64Histogram
-	HistogramLatencyReturnTrip  otelapi.Float64Histogram
+	HistogramHTTPConnect         otelapi.Float64Histogram
+	HistogramHTTPDNS             otelapi.Float64Histogram
+	HistogramHTTPTLS             otelapi.Float64Histogram
+	HistogramHTTPTimeToFirstByte otelapi.Float64Histogram
+	HistogramHTTPTotal           otelapi.Float64Histogram
+
+	HistogramLatencyForwardTrip        otelapi.Float64Histogram
+	HistogramLatencyInboundForwardTrip otelapi.Float64Histogram
+	HistogramLatencyReturnTrip         otelapi.Float64Histogram
+	HistogramLatencyRoundTrip          otelapi.Float64Histogram
 )
 
 func Setup(ctx context.Context, cfg *config.Metrics) error {
@@ -35,15 +70,31 @@ func Setup(ctx context.Context, cfg *config.Metrics) error {
 		setupMeter,               // must come first
 		setupLatencyBoundariesUs, // must come second
 
+		setupCounterProbeReceived,
+		setupCounterProbeResponded,
 		setupCounterProbeReturned,
 		setupCounterProbeSent,
 
+		setupCounterDSCPRemarked,
 		setupCounterFailedProbeRespond,
 		setupCounterInvalidProbes,
 		setupCounterFailedProbeSend,
+		setupCounterLabelOverflow,
+		setupCounterPathChange,
+		setupCounterPeerReconnect,
+		setupCounterProbeRejected,
+		setupCounterProbeReplyThrottled,
+
+		setupGaugesLatency,
+		setupGaugeLatencyQuantile,
+		setupGaugeMode,
+		setupGaugePathHopCount,
+		setupGaugesPeer,
+		setupGaugeQUICSmoothedRTT,
 
-		setupHistogramLatencyForwardTrip,
-		setupHistogramLatencyReturnTrip,
+		setupHistogramsHTTP,
+		setupHistogramsLatency,
+		setupHistogramLatencyInbound,
 	} {
 		if err := setup(ctx, cfg); err != nil {
 			return err
@@ -60,25 +111,81 @@ func setupMeter(ctx context.Context, cfg *config.Metrics) error {
 		return err
 	}
 
-	exporter, err := prometheus.New(
-		prometheus.WithNamespace(metricsNamespace),
-		prometheus.WithoutScopeInfo(),
-	)
-	if err != nil {
-		return err
+	exporters := cfg.Exporters
+	if len(exporters) == 0 {
+		exporters = []string{config.ExporterPrometheus}
 	}
 
-	provider := metric.NewMeterProvider(
-		metric.WithReader(exporter),
+	options := []metric.Option{
+		metric.WithExemplarFilter(exemplarFilter(cfg)),
 		metric.WithResource(res),
-	)
+		metric.WithView(view(cfg)),
+	}
+	for _, exporter := range exporters {
+		reader, err := newReader(ctx, exporter, cfg)
+		if err != nil {
+			return err
+		}
+		options = append(options, metric.WithReader(reader))
+	}
+
+	provider = metric.NewMeterProvider(options...)
 
 	meter = provider.Meter(metricsNamespace)
 
 	return nil
 }
 
+// view shapes the streams of all of the instruments (it must be the only one,
+// since every matching view yields a stream of its own): the attributes meant
+// for the exemplars are dropped, and the latencies get the exponential
+// histograms if configured.
+func view(cfg *config.Metrics) metric.View {
+	dropExemplarKeys := otelattr.NewDenyKeysFilter(
+		exemplarKeySequence,
+		exemplarKeySrcTimestamp,
+		exemplarKeyDstTimestamp,
+	)
+
+	return func(i metric.Instrument) (metric.Stream, bool) {
+		stream := metric.Stream{
+			Name:            i.Name,
+			Description:     i.Description,
+			Unit:            i.Unit,
+			AttributeFilter: dropExemplarKeys,
+		}
+		if cfg.LatencyHistogram == config.HistogramExponential &&
+			i.Kind == metric.InstrumentKindHistogram &&
+			i.Unit == unitMicroseconds { // all of the latencies
+			stream.Aggregation = metric.AggregationBase2ExponentialHistogram{
+				MaxSize:  int32(cfg.LatencyHistogramMaxSize),
+				MaxScale: int32(cfg.LatencyHistogramMaxScale),
+			}
+		}
+		return stream, true
+	}
+}
+
+// RegisterCallback registers the callback that observes the instruments
+// whenever the metrics are collected.
+func RegisterCallback(f otelapi.Callback, instruments ...otelapi.Observable) (otelapi.Registration, error) {
+	return meter.RegisterCallback(f, instruments...)
+}
+
+// Shutdown flushes the metrics not yet pushed by the exporters (if any).
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
 func setupLatencyBoundariesUs(ctx context.Context, cfg *config.Metrics) error {
+	if len(cfg.LatencyBuckets) > 0 {
+		latencyBoundariesUs = otelapi.WithExplicitBucketBoundaries(cfg.LatencyBuckets...)
+		return nil
+	}
+
 	latencyBoundariesUs = otelapi.WithExplicitBucketBoundaries(func() []float64 {
 		base := math.Exp(math.Log(float64(cfg.MaxLatencyUs)) / (float64(cfg.LatencyBucketsCount - 1)))
 		res := make([]float64, 0, cfg.LatencyBucketsCount)
@@ -93,6 +200,30 @@ func setupLatencyBoundariesUs(ctx context.Context, cfg *config.Metrics) error {
 	return nil
 }
 
+func setupCounterProbeReceived(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"probe_received_count",
+		otelapi.WithDescription("count of the others' probes received"),
+	)
+	CountProbeReceived = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupCounterProbeResponded(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"probe_responded_count",
+		otelapi.WithDescription("count of probes responded to"),
+	)
+	CountProbeResponded = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func setupCounterProbeReturned(_ context.Context, _ *config.Metrics) error {
 	counter, err := meter.Int64Counter(
 		"probe_returned_count",
@@ -129,6 +260,18 @@ func setupCounterFailedProbeSend(_ context.Context, _ *config.Metrics) error {
 	return nil
 }
 
+func setupCounterDSCPRemarked(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"probe_dscp_remarked_count",
+		otelapi.WithDescription("count of probes that arrived with dscp different from the one they were sent with"),
+	)
+	CounterDSCPRemarked = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func setupCounterFailedProbeRespond(_ context.Context, _ *config.Metrics) error {
 	counter, err := meter.Int64Counter(
 		"failed_probe_respond_count",
@@ -153,30 +296,170 @@ func setupCounterInvalidProbes(_ context.Context, _ *config.Metrics) error {
 	return nil
 }
 
-func setupHistogramLatencyForwardTrip(_ context.Context, _ *config.Metrics) error {
-	latency, err := meter.Float64Histogram(
-		"forward_trip_latency",
-		otelapi.WithDescription("statistics on the latency of probes' forward-trip"),
-		otelapi.WithUnit("us"),
-		latencyBoundariesUs,
+func setupCounterLabelOverflow(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"label_overflow_count",
+		otelapi.WithDescription("count of label values reported as 'other' to keep the cardinality of the metrics at bay"),
+	)
+	CounterLabelOverflow = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupCounterPathChange(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"path_change_count",
+		otelapi.WithDescription("count of changes of the discovered paths towards the peers"),
 	)
-	HistogramLatencyForwardTrip = latency
+	CounterPathChange = counter
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func setupHistogramLatencyReturnTrip(_ context.Context, _ *config.Metrics) error {
-	latency, err := meter.Float64Histogram(
-		"return_trip_latency",
-		otelapi.WithDescription("statistics on the latency of probes' return-trip"),
-		otelapi.WithUnit("us"),
-		latencyBoundariesUs,
+func setupCounterPeerReconnect(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"peer_reconnect_count",
+		otelapi.WithDescription("count of re-establishing the connections to the peers (quic or tcp stream)"),
 	)
-	HistogramLatencyReturnTrip = latency
+	CounterPeerReconnect = counter
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func setupCounterProbeRejected(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"probe_rejected_count",
+		otelapi.WithDescription("count of probes rejected because their source is not allowed"),
+	)
+	CounterProbeRejected = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupCounterProbeReplyThrottled(_ context.Context, _ *config.Metrics) error {
+	counter, err := meter.Int64Counter(
+		"probe_reply_throttled_count",
+		otelapi.WithDescription("count of replies to the probes dropped due to rate limits"),
+	)
+	CounterProbeReplyThrottled = counter
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupGaugeLatencyQuantile(_ context.Context, _ *config.Metrics) error {
+	gauge, err := meter.Float64ObservableGauge(
+		"latency_quantile",
+		otelapi.WithDescription("estimate of the latency quantile over the sliding window"),
+		otelapi.WithUnit(unitMicroseconds),
+	)
+	GaugeLatencyQuantile = gauge
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupGaugeMode(_ context.Context, _ *config.Metrics) error {
+	gauge, err := meter.Int64Gauge(
+		"mode_info",
+		otelapi.WithDescription("mode the transponder runs in (reported via the label)"),
+	)
+	GaugeMode = gauge
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupGaugePathHopCount(_ context.Context, _ *config.Metrics) error {
+	gauge, err := meter.Int64Gauge(
+		"path_hop_count",
+		otelapi.WithDescription("count of hops on the latest discovered path towards the peer"),
+	)
+	GaugePathHopCount = gauge
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupGaugesPeer(_ context.Context, _ *config.Metrics) error {
+	info, err := meter.Int64ObservableGauge(
+		"peer_info",
+		otelapi.WithDescription("static metadata of the peer (reported via the labels)"),
+	)
+	GaugePeerInfo = info
+	if err != nil {
+		return err
+	}
+
+	lastSeen, err := meter.Float64ObservableGauge(
+		"peer_last_seen_timestamp",
+		otelapi.WithDescription("unix timestamp of the latest probe returned from the peer"),
+		otelapi.WithUnit("s"),
+	)
+	GaugePeerLastSeen = lastSeen
+	if err != nil {
+		return err
+	}
+
+	up, err := meter.Int64ObservableGauge(
+		"peer_up",
+		otelapi.WithDescription("whether the peer has returned a probe recently (1) or not (0)"),
+	)
+	GaugePeerUp = up
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func setupGaugeQUICSmoothedRTT(_ context.Context, _ *config.Metrics) error {
+	gauge, err := meter.Float64Gauge(
+		"quic_smoothed_rtt",
+		otelapi.WithDescription("round-trip time of quic connections to the peers as estimated by quic itself"),
+		otelapi.WithUnit(unitMicroseconds),
+	)
+	GaugeQUICSmoothedRTT = gauge
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setupHistogramsHTTP(_ context.Context, _ *config.Metrics) error {
+	for _, h := range []struct {
+		histogram   *otelapi.Float64Histogram
+		name        string
+		description string
+	}{
+		{&HistogramHTTPConnect, "http_connect_latency", "statistics on the time to connect to http peers"},
+		{&HistogramHTTPDNS, "http_dns_latency", "statistics on the time to resolve the hostnames of http peers"},
+		{&HistogramHTTPTLS, "http_tls_latency", "statistics on the time of tls handshakes with https peers"},
+		{&HistogramHTTPTimeToFirstByte, "http_time_to_first_byte_latency", "statistics on the time from sending the request to http peers until the first byte of their response"},
+		{&HistogramHTTPTotal, "http_total_latency", "statistics on the total time of requests to http peers"},
+	} {
+		latency, err := meter.Float64Histogram(
+			h.name,
+			otelapi.WithDescription(h.description),
+			otelapi.WithUnit(unitMicroseconds),
+			latencyBoundariesUs,
+		)
+		*h.histogram = latency
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponentialHistograms(t *testing.T) {
+	require.NoError(t, metrics.Setup(context.Background(), &config.Metrics{
+		Exporters:                []string{config.ExporterPrometheus},
+		LatencyBucketsCount:      33,
+		LatencyHistogram:         config.HistogramExponential,
+		LatencyHistogramMaxScale: 20,
+		LatencyHistogramMaxSize:  160,
+		MaxLatencyUs:             1000000,
+	}))
+
+	for us := 100; us <= 2000; us += 10 {
+		metrics.HistogramLatencyRoundTrip.Record(context.Background(), float64(us))
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "latency_monitor_round_trip_latency_microseconds" {
+			continue
+		}
+		h := family.GetMetric()[0].GetHistogram()
+		require.Equal(t, uint64(191), h.GetSampleCount())
+		require.Empty(t, h.GetBucket()) // no classic buckets
+		require.NotEmpty(t, h.GetPositiveSpan())
+		require.Greater(t, h.GetSchema(), int32(0)) // 100..2000 fits at fine resolution
+		require.LessOrEqual(t, h.GetSchema(), int32(8))
+		return
+	}
+	require.Fail(t, "round trip latency histogram is missing")
+}
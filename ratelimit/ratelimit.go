@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+)
+
+// Limiter is a token-bucket rate limiter with a bucket per source ip, and
+// a global one on top of them.  Zero rate disables the respective bucket.
+type Limiter struct {
+	global *bucket
+	perSrc map[string]*bucket
+
+	srcRate  float64
+	srcBurst float64
+
+	cleanupInterval time.Duration
+	cleanedUp       time.Time
+
+	mx sync.Mutex
+}
+
+type bucket struct {
+	rate  float64
+	burst float64
+
+	tokens  float64
+	updated time.Time
+}
+
+const (
+	ReasonGlobal = "global"
+	ReasonSource = "source"
+)
+
+func New(cfg *config.Responder) *Limiter {
+	l := &Limiter{
+		perSrc: make(map[string]*bucket),
+
+		srcRate:  cfg.RateLimitPerSource,
+		srcBurst: float64(max(cfg.RateLimitPerSourceBurst, 1)),
+
+		cleanupInterval: time.Second,
+	}
+
+	if cfg.RateLimitGlobal > 0 {
+		l.global = &bucket{
+			rate:   cfg.RateLimitGlobal,
+			burst:  float64(max(cfg.RateLimitGlobalBurst, 1)),
+			tokens: float64(max(cfg.RateLimitGlobalBurst, 1)),
+		}
+	}
+
+	return l
+}
+
+// Allow tells whether one more datagram can be sent to the source at the
+// moment, and if not then which of the limits has been hit.
+func (l *Limiter) Allow(source net.IP, now time.Time) (bool, string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	var src *bucket
+	if l.srcRate > 0 {
+		l.cleanup(now)
+
+		key := string(source.To16())
+		src = l.perSrc[key]
+		if src == nil {
+			src = &bucket{
+				rate:   l.srcRate,
+				burst:  l.srcBurst,
+				tokens: l.srcBurst,
+			}
+			l.perSrc[key] = src
+		}
+		if !src.available(now) {
+			return false, ReasonSource
+		}
+	}
+
+	if l.global != nil && !l.global.available(now) {
+		return false, ReasonGlobal
+	}
+
+	if src != nil {
+		src.tokens -= 1
+	}
+	if l.global != nil {
+		l.global.tokens -= 1
+	}
+
+	return true, ""
+}
+
+// cleanup forgets the sources whose buckets have been refilled (so that
+// a flood from the spoofed addresses does not exhaust the memory).
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.cleanedUp) < l.cleanupInterval {
+		return
+	}
+	l.cleanedUp = now
+
+	for key, src := range l.perSrc {
+		if src.refill(now); src.tokens >= src.burst {
+			delete(l.perSrc, key)
+		}
+	}
+}
+
+func (b *bucket) available(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.updated.IsZero() {
+		b.updated = now
+		return
+	}
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+b.rate*elapsed.Seconds())
+		b.updated = now
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterPerSource(t *testing.T) {
+	l := ratelimit.New(&config.Responder{
+		RateLimitPerSource:      10,
+		RateLimitPerSourceBurst: 5,
+	})
+
+	now := time.Now()
+	victim := net.ParseIP("192.0.2.1")
+	other := net.ParseIP("192.0.2.2")
+
+	for i := 0; i < 5; i++ {
+		allowed, _ := l.Allow(victim, now)
+		require.True(t, allowed)
+	}
+
+	allowed, reason := l.Allow(victim, now)
+	require.False(t, allowed)
+	require.Equal(t, ratelimit.ReasonSource, reason)
+
+	allowed, _ = l.Allow(other, now)
+	require.True(t, allowed, "other sources must not be affected")
+
+	allowed, _ = l.Allow(victim, now.Add(100*time.Millisecond))
+	require.True(t, allowed, "bucket must refill at the configured rate")
+}
+
+func TestLimiterGlobal(t *testing.T) {
+	l := ratelimit.New(&config.Responder{
+		RateLimitGlobal:         100,
+		RateLimitGlobalBurst:    10,
+		RateLimitPerSource:      10,
+		RateLimitPerSourceBurst: 5,
+	})
+
+	now := time.Now()
+	allowedCount := 0
+	for i := 0; i < 100; i++ { // spoofed flood from many sources
+		source := net.IPv4(198, 51, 100, byte(i))
+		if allowed, reason := l.Allow(source, now); allowed {
+			allowedCount++
+		} else {
+			require.Equal(t, ratelimit.ReasonGlobal, reason)
+		}
+	}
+	require.Equal(t, 10, allowedCount)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := ratelimit.New(&config.Responder{})
+
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		allowed, _ := l.Allow(net.ParseIP("192.0.2.1"), now)
+		require.True(t, allowed)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/flashbots/latency-monitor/config"
+)
+
+const (
+	rejectReasonMode    = "mode"
+	rejectReasonNetwork = "network"
+	rejectReasonPeer    = "peer"
+	rejectReasonSize    = "size"
+)
+
+// allowlist decides whom the transponder talks to.
+type allowlist struct {
+	networks  []*net.IPNet
+	peersOnly bool
+
+	peerIPs map[string]struct{} // ips the peers have ever resolved to
+	mx      sync.RWMutex
+}
+
+func newAllowlist(cfg *config.Responder) *allowlist {
+	return &allowlist{
+		networks:  cfg.AllowedNetworks,
+		peersOnly: cfg.AllowPeersOnly,
+		peerIPs:   make(map[string]struct{}),
+	}
+}
+
+func (a *allowlist) addPeer(ip net.IP) {
+	if !a.peersOnly {
+		return
+	}
+
+	key := string(ip.To16())
+
+	a.mx.RLock()
+	_, known := a.peerIPs[key]
+	a.mx.RUnlock()
+	if known {
+		return
+	}
+
+	a.mx.Lock()
+	a.peerIPs[key] = struct{}{}
+	a.mx.Unlock()
+}
+
+// allow tells whether the ip is allowed, and if not then why.
+func (a *allowlist) allow(ip net.IP) (bool, string) {
+	if len(a.networks) > 0 {
+		allowed := false
+		for _, network := range a.networks {
+			if network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, rejectReasonNetwork
+		}
+	}
+
+	if a.peersOnly {
+		a.mx.RLock()
+		_, known := a.peerIPs[string(ip.To16())]
+		a.mx.RUnlock()
+		if !known {
+			return false, rejectReasonPeer
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/metrics"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+const (
+	locationOther = "other"
+
+	overflowReasonLimit      = "limit"
+	overflowReasonNotAllowed = "not_allowed"
+)
+
+// locationLabels guards the cardinality of the labels that carry the
+// locations as they came over the wire (i.e. whatever the remote side has
+// sent).  The locations beyond the limit (or the allowed ones) are reported
+// as "other".
+type locationLabels struct {
+	allowed map[string]struct{} // any location is allowed if empty
+	limit   int                 // of the distinct values per label (0 for no limit)
+	labels  otelapi.MeasurementOption
+
+	seen map[locationLabel]map[string]struct{}
+	mx   sync.Mutex
+}
+
+type locationLabel struct {
+	metric string
+	label  string
+}
+
+func newLocationLabels(cfg *config.Metrics, labels otelapi.MeasurementOption) *locationLabels {
+	allowed := make(map[string]struct{}, len(cfg.AllowedLocations))
+	for _, location := range cfg.AllowedLocations {
+		allowed[location] = struct{}{}
+	}
+	if len(allowed) > 0 {
+		allowed[cfg.Location] = struct{}{} // we are always allowed
+	}
+
+	return &locationLabels{
+		allowed: allowed,
+		limit:   cfg.MaxLocations,
+		labels:  labels,
+		seen:    make(map[locationLabel]map[string]struct{}),
+	}
+}
+
+// value returns the value of the metric's label for the location.
+func (l *locationLabels) value(ctx context.Context, metric, label, location string) string {
+	reason := ""
+
+	if _, allowed := l.allowed[location]; len(l.allowed) > 0 && !allowed {
+		reason = overflowReasonNotAllowed
+	} else if l.limit > 0 {
+		key := locationLabel{metric, label}
+
+		l.mx.Lock()
+		values, exist := l.seen[key]
+		if !exist {
+			values = make(map[string]struct{})
+			l.seen[key] = values
+		}
+		if _, known := values[location]; !known {
+			if len(values) < l.limit {
+				values[location] = struct{}{}
+			} else {
+				reason = overflowReasonLimit
+			}
+		}
+		l.mx.Unlock()
+	}
+
+	if reason == "" {
+		return location
+	}
+
+	metrics.CounterLabelOverflow.Add(ctx, 1, l.labels, otelapi.WithAttributes(
+		otelattr.String("metric", metric),
+		otelattr.String("label", label),
+		otelattr.String("reason", reason),
+	))
+	return locationOther
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocationLabels(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Metrics.MaxLocations = 2
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	labels := map[string]string{"metric": "test_metric", "reason": overflowReasonLimit}
+	overflowBefore := counterValue(t, "latency_monitor_label_overflow_count_total", labels)
+
+	for _, tc := range []struct{ location, expected string }{
+		{"loc-a", "loc-a"},
+		{"loc-b", "loc-b"},
+		{"loc-c", locationOther},
+		{"loc-a", "loc-a"},
+	} {
+		require.Equal(t, tc.expected, s.locations.value(ctx, "test_metric", "from", tc.location))
+	}
+	require.Equal(t, "loc-c", s.locations.value(ctx, "test_metric", "to", "loc-c"))
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_label_overflow_count_total", labels)-overflowBefore)
+
+	cfg = newTestConfig()
+	cfg.Metrics.AllowedLocations = []string{"loc-a"}
+	s, _ = newTestServer(t, cfg)
+
+	require.Equal(t, "loc-a", s.locations.value(ctx, "test_metric", "from", "loc-a"))
+	require.Equal(t, "test", s.locations.value(ctx, "test_metric", "from", "test"))
+	require.Equal(t, locationOther, s.locations.value(ctx, "test_metric", "from", "loc-b"))
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// connDialer maintains the connection to the peer that the probes are
+// exchanged over (quic or tcp stream).
+type connDialer interface {
+	IsConnected() bool
+	Send(data []byte) error
+}
+
+// sendConnProbe sends the probe to the peer over the connection maintained by
+// the dialer, and tells whether it succeeded.
+func (s *Server) sendConnProbe(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer, protocol string, d connDialer) bool {
+	l := logutils.LoggerFromContext(ctx)
+
+	if !d.IsConnected() {
+		l.Warn("Connection is not established...",
+			zap.String("peer", peer.Name()),
+			zap.String("protocol", protocol),
+		)
+		return false
+	}
+
+	p := types.Probe{
+		Sequence:    peer.Sequence(),
+		SrcUUID:     s.uuid,
+		SrcLocation: s.location,
+		SrcDSCP:     peer.DSCP(),
+		DstUUID:     peerUUID,
+	}
+	p.SrcTimestamp = time.Now()
+
+	b, err := p.MarshalBinary()
+	if err != nil {
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to prepare a probe",
+			zap.Error(err),
+		)
+		return false
+	}
+
+	if err := d.Send(b); err != nil {
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to send a probe",
+			zap.Error(err),
+			zap.String("peer", peer.Name()),
+		)
+		return false
+	}
+
+	sentAttrs := []otelattr.KeyValue{
+		otelattr.String("peer", peer.Name()),
+		otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+		otelattr.String("source", peer.Source().String()),
+		otelattr.String("protocol", protocol),
+	}
+	metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(sentAttrs...))
+	s.statsd.Count("probe_sent_count", 1, sentAttrs...)
+	l.Debug("Sent a probe",
+		zap.String("name", peer.Name()),
+	)
+
+	return true
+}
+
+// receiveConn handles the probes received over the connections of the
+// protocol (both the others' ones, and our own returned).
+func (s *Server) receiveConn(ctx context.Context, protocol string) transponder.ConnReceive {
+	return func(name string, data []byte, addr net.Addr, send func([]byte, uint8) error) {
+		s.handleProbe(ctx, protocol, name, data, addr, types.DSCPUnknown, func(output []byte, dscp uint8, onError func(error)) {
+			if err := send(output, dscp); err != nil {
+				onError(err)
+			}
+		})
+	}
+}
+
+// acceptConn returns the hook that decides whether to accept the connection
+// on the listener (so that the rejected sources would not hold it open).
+func (s *Server) acceptConn(ctx context.Context, listener string) func(net.Addr) bool {
+	l := logutils.LoggerFromContext(ctx)
+	return func(addr net.Addr) bool {
+		allowed, reason := s.allowlist.allow(addrIP(addr))
+		if allowed && !s.cfg.Transponder.Responds() {
+			allowed, reason = false, rejectReasonMode
+		}
+		if !allowed {
+			metrics.CounterProbeRejected.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("reason", reason),
+				otelattr.String("listener", listener),
+			))
+			l.Debug("Rejected a connection",
+				zap.String("reason", reason),
+				zap.String("source", addr.String()),
+			)
+		}
+		return allowed
+	}
+}
+
+// countReconnects returns the hook that counts re-establishing of the
+// connection to the peer.
+func (s *Server) countReconnects(ctx context.Context, peer *types.Peer, protocol string) func() {
+	name := peer.Name()
+	return func() {
+		metrics.CounterPeerReconnect.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("peer", name),
+			otelattr.String("protocol", protocol),
+		))
+	}
+}
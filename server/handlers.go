@@ -1,9 +1,18 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 )
 
+type healthcheck struct {
+	Mode string `json:"mode"`
+}
+
 func (s *Server) handleHealthcheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(healthcheck{
+		Mode: s.cfg.Transponder.Mode,
+	})
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	protocolHTTP = "http"
+)
+
+// newHTTPClient returns the client for the requests to http(s) peer.  The
+// connections are not reused, so that every request goes through all of the
+// phases (dns, connect, tls).
+func (s *Server) newHTTPClient(peer *types.Peer) *http.Client {
+	dialer := transponder.NewDialer(peer.Source(), peer.DSCP(), s.cfg.Transponder.ConnectTimeout)
+
+	return &http.Client{
+		Timeout: s.cfg.Transponder.ConnectTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			DisableKeepAlives:   true,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: s.cfg.Transponder.ConnectTimeout,
+		},
+	}
+}
+
+// sendHTTPRequest measures the phases of the request to http(s) peer.  The
+// request is made asynchronously, so that slow peers do not delay the others'
+// probes.
+func (s *Server) sendHTTPRequest(ctx context.Context, client *http.Client, peerUUID uuid.UUID, peer *types.Peer) {
+	l := logutils.LoggerFromContext(ctx)
+
+	peerAttrs := []otelattr.KeyValue{
+		otelattr.String("peer", peer.Name()),
+		otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+		otelattr.String("source", peer.Source().String()),
+		otelattr.String("protocol", protocolHTTP),
+	}
+	attrs := otelapi.WithAttributes(peerAttrs...)
+	record := func(h otelapi.Float64Histogram, name string, start, end time.Time) {
+		if start.IsZero() || end.IsZero() { // the phase did not happen
+			return
+		}
+		latency := float64(end.Sub(start).Microseconds())
+		h.Record(ctx, latency, s.labels, attrs)
+		s.statsd.Timing(name, latency, peerAttrs...)
+	}
+
+	metrics.CountProbeSent.Add(ctx, 1, s.labels, attrs)
+	s.statsd.Count("probe_sent_count", 1, peerAttrs...)
+
+	go func() {
+		var (
+			dnsStart, dnsDone             time.Time
+			connectStart, connectDone     time.Time
+			tlsStart, tlsDone             time.Time
+			wroteRequest, firstByte, done time.Time
+
+			// with both ip4 and ip6 addresses, the dialer connects to them in
+			// parallel (happy eyeballs), and the one that wins is measured
+			connectStarts = make(map[string]time.Time)
+			connectMx     sync.Mutex
+		)
+		trace := &httptrace.ClientTrace{
+			DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+			DNSDone:  func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+			ConnectStart: func(_, addr string) {
+				connectMx.Lock()
+				defer connectMx.Unlock()
+				connectStarts[addr] = time.Now()
+			},
+			ConnectDone: func(_, addr string, err error) {
+				connectMx.Lock()
+				defer connectMx.Unlock()
+				if err == nil && connectDone.IsZero() {
+					connectStart, connectDone = connectStarts[addr], time.Now()
+				}
+			},
+			TLSHandshakeStart:    func() { tlsStart = time.Now() },
+			TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+			WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+			GotFirstResponseByte: func() { firstByte = time.Now() },
+		}
+
+		var body io.Reader
+		if peer.Body() != "" {
+			body = strings.NewReader(peer.Body())
+		}
+		req, err := http.NewRequestWithContext(
+			httptrace.WithClientTrace(ctx, trace), peer.Method(), peer.URL().String(), body,
+		)
+		if err != nil {
+			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", connectErrorOther),
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("protocol", protocolHTTP),
+			))
+			l.Error("Failed to prepare http request",
+				zap.Error(err),
+				zap.String("peer", peer.Name()),
+			)
+			return
+		}
+		for name, values := range peer.Header() {
+			req.Header[name] = values
+		}
+		if host := peer.Header().Get("Host"); host != "" { // net/http only takes it from here
+			req.Host = host
+		}
+
+		start := time.Now()
+		res, err := client.Do(req)
+		if err == nil {
+			_, err = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		done = time.Now()
+		if err != nil {
+			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", classifyConnectError(err)),
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("protocol", protocolHTTP),
+			))
+			l.Warn("Failed to request http peer",
+				zap.Error(err),
+				zap.String("peer", peer.Name()),
+			)
+			return
+		}
+
+		record(metrics.HistogramHTTPDNS, "http_dns_latency", dnsStart, dnsDone)
+		connectMx.Lock() // the losing dials might still be finishing
+		record(metrics.HistogramHTTPConnect, "http_connect_latency", connectStart, connectDone)
+		connectMx.Unlock()
+		record(metrics.HistogramHTTPTLS, "http_tls_latency", tlsStart, tlsDone)
+		record(metrics.HistogramHTTPTimeToFirstByte, "http_time_to_first_byte_latency", wroteRequest, firstByte)
+		totalLatency := float64(done.Sub(start).Microseconds())
+		statusCode := otelattr.String("status_code", strconv.Itoa(res.StatusCode))
+		metrics.HistogramHTTPTotal.Record(ctx, totalLatency, s.labels, attrs, otelapi.WithAttributes(statusCode))
+		s.statsd.Timing("http_total_latency", totalLatency, append(slices.Clone(peerAttrs), statusCode)...)
+
+		metrics.CountProbeReturned.Add(ctx, 1, s.labels, attrs)
+		s.markSeen(peerUUID, "")
+		s.statsd.Count("probe_returned_count", 1, peerAttrs...)
+		l.Debug("Received http response",
+			zap.Int("status_code", res.StatusCode),
+			zap.Duration("total", done.Sub(start)),
+			zap.String("name", peer.Name()),
+		)
+	}()
+}
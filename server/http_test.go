@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPPhases(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || string(body) != `{"method":"eth_blockNumber"}` || r.Header.Get("X-Test") != "yes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"result":"0x1"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, err := types.NewPeer(`rpc=` + srv.URL + `/rpc;method=post;body={"method":"eth_blockNumber"};header=X-Test: yes`)
+	require.NoError(t, err)
+	require.Equal(t, types.PeerKindHTTP, peer.Kind())
+
+	labels := map[string]string{"peer": "rpc", "protocol": "http"}
+	before := map[string]uint64{}
+	for _, name := range []string{"dns", "connect", "tls", "time_to_first_byte", "total"} {
+		before[name] = histogramCount(t, "latency_monitor_http_"+name+"_latency_microseconds", labels)
+	}
+
+	s.sendHTTPRequest(context.Background(), s.newHTTPClient(&peer), uuid.New(), &peer)
+
+	require.Eventually(t, func() bool {
+		return histogramCount(t, "latency_monitor_http_total_latency_microseconds", map[string]string{
+			"peer": "rpc", "status_code": "200",
+		})-before["total"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, uint64(1), histogramCount(t, "latency_monitor_http_connect_latency_microseconds", labels)-before["connect"])
+	require.Equal(t, uint64(1), histogramCount(t, "latency_monitor_http_time_to_first_byte_latency_microseconds", labels)-before["time_to_first_byte"])
+	require.Equal(t, uint64(0), histogramCount(t, "latency_monitor_http_dns_latency_microseconds", labels)-before["dns"]) // ip literal
+	require.Equal(t, uint64(0), histogramCount(t, "latency_monitor_http_tls_latency_microseconds", labels)-before["tls"]) // plain http
+}
+
+func TestHTTPHostHeader(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "rpc.example.com" {
+			w.WriteHeader(http.StatusMisdirectedRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, err := types.NewPeer(`vhost=` + srv.URL + `;header=Host: rpc.example.com`)
+	require.NoError(t, err)
+
+	labels := map[string]string{"peer": "vhost", "status_code": "200"}
+	before := histogramCount(t, "latency_monitor_http_total_latency_microseconds", labels)
+
+	s.sendHTTPRequest(context.Background(), s.newHTTPClient(&peer), uuid.New(), &peer)
+
+	require.Eventually(t, func() bool {
+		return histogramCount(t, "latency_monitor_http_total_latency_microseconds", labels)-before == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMalformedEchoReply = errors.New("malformed icmp echo reply")
+	ErrUnexpectedEchoPeer = errors.New("unexpected peer uuid in icmp echo reply")
+)
+
+const (
+	protocolICMP = "icmp"
+
+	echoPayloadSize = 24 // peer uuid + send timestamp
+)
+
+// sendEchoRequest sends an icmp echo request to the peer.  The payload carries
+// everything that is needed to handle the reply (see receiveEchoReplies).
+func (s *Server) sendEchoRequest(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer, ip net.IP) {
+	l := logutils.LoggerFromContext(ctx)
+
+	network := "ip4"
+	if ip.To4() == nil {
+		network = "ip6"
+	}
+
+	p, exists := s.pingers[pingerKey(network, peer.Source())]
+	if !exists {
+		err := fmt.Errorf("%w: %s",
+			ErrNoSuitableListener, ip.String(),
+		)
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to send an icmp echo request",
+			zap.Error(err),
+			zap.String("peer", peer.Name()),
+		)
+		return
+	}
+	if !p.IsRunning() {
+		l.Warn("Pinger is not running...",
+			zap.String("pinger", p.Name()),
+		)
+		return
+	}
+
+	payload := make([]byte, echoPayloadSize)
+	copy(payload[0:16], peerUUID[:])
+	binary.BigEndian.PutUint64(payload[16:24], uint64(time.Now().UnixNano()))
+
+	if err := p.Send(ip, int(peer.Sequence()), payload, peer.DSCP()); err != nil {
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to send an icmp echo request",
+			zap.Error(err),
+			zap.String("peer", peer.Name()),
+		)
+		return
+	}
+
+	sentAttrs := []otelattr.KeyValue{
+		otelattr.String("peer", peer.Name()),
+		otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+		otelattr.String("source", peer.Source().String()),
+		otelattr.String("protocol", protocolICMP),
+	}
+	metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(sentAttrs...))
+	s.statsd.Count("probe_sent_count", 1, sentAttrs...)
+	l.Debug("Sent an icmp echo request",
+		zap.String("name", peer.Name()),
+	)
+}
+
+func (s *Server) receiveEchoReplies(ctx context.Context) transponder.PingReceive {
+	l := logutils.LoggerFromContext(ctx)
+
+	return func(p *transponder.Pinger, data []byte, from net.IP) {
+		ts := time.Now()
+
+		if len(data) < echoPayloadSize {
+			err := fmt.Errorf("%w: %d bytes",
+				ErrMalformedEchoReply, len(data),
+			)
+			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", p.Name()),
+			))
+			l.Error("Invalid icmp echo reply",
+				zap.Error(err),
+				zap.String("source", from.String()),
+			)
+			return
+		}
+
+		peerUUID, _ := uuid.FromBytes(data[0:16])
+		peer, known := s.peers[peerUUID]
+		if !known || peer.Kind() != types.PeerKindICMP {
+			err := fmt.Errorf("%w: %s",
+				ErrUnexpectedEchoPeer, peerUUID.String(),
+			)
+			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", p.Name()),
+			))
+			l.Error("Invalid icmp echo reply",
+				zap.Error(err),
+				zap.String("source", from.String()),
+			)
+			return
+		}
+
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(data[16:24])))
+		dscp := strconv.Itoa(int(peer.DSCP()))
+		peerSource := peer.Source().String()
+
+		roundTripLatency := float64(ts.Sub(sent).Microseconds())
+		roundTripAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocolICMP),
+		}
+		metrics.Latency(peer.BucketProfile()).RoundTrip.Record(ctx, roundTripLatency, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocolICMP, directionRoundTrip}, roundTripLatency, roundTripAttrs...)
+		s.statsd.Timing("round_trip_latency", roundTripLatency, roundTripAttrs...)
+
+		metrics.CountProbeReturned.Add(ctx, 1, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.markSeen(peerUUID, "")
+		s.statsd.Count("probe_returned_count", 1, roundTripAttrs...)
+		l.Debug("Received an icmp echo reply",
+			zap.Float64("round_trip_latency_ms", roundTripLatency),
+			zap.String("name", peer.Name()),
+		)
+	}
+}
+
+// icmpNetwork returns the network of the pinger the peer should be pinged
+// through (the peers with hostnames are resolved to ip4, see Peer.UDPAddress).
+func icmpNetwork(peer *types.Peer) string {
+	if addr, err := peer.UDPAddress(); err == nil && addr.IP.To4() == nil {
+		return "ip6"
+	}
+	return "ip4"
+}
+
+func pingerKey(network string, source types.Source) string {
+	return network + "/" + source.String()
+}
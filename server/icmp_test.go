@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICMPLoopback(t *testing.T) {
+	cfg := newTestConfig()
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	peer, err := types.NewPeer("loopback=icmp://127.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, types.PeerKindICMP, peer.Kind())
+	s.peers = map[uuid.UUID]*types.Peer{uuid.New(): &peer}
+
+	p := transponder.NewPinger(icmpNetwork(&peer), peer.Source())
+	p.Receive = s.receiveEchoReplies(ctx)
+	s.pingers[pingerKey(icmpNetwork(&peer), peer.Source())] = p
+
+	failure := make(chan error, 1)
+	go func() {
+		failure <- p.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		_ = p.Shutdown(ctx)
+	})
+	for deadline := time.Now().Add(time.Second); !p.IsRunning(); time.Sleep(time.Millisecond) {
+		select {
+		case err := <-failure:
+			if errors.Is(err, os.ErrPermission) {
+				t.Skip("neither unprivileged nor raw icmp sockets are permitted")
+			}
+			require.NoError(t, err)
+		default:
+		}
+		require.True(t, time.Now().Before(deadline), "pinger did not start")
+	}
+
+	labels := map[string]string{"peer": "loopback", "protocol": "icmp"}
+	returnedBefore := counterValue(t, "latency_monitor_probe_returned_count_total", labels)
+
+	s.sendProbes(ctx)
+
+	require.Eventually(t, func() bool {
+		return counterValue(t, "latency_monitor_probe_returned_count_total", labels)-returnedBefore == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flashbots/latency-monitor/metrics"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+const (
+	directionForward   = "forward"
+	directionReturn    = "return"
+	directionRoundTrip = "round_trip"
+)
+
+// latencyKey identifies the series of the latency measurements.
+type latencyKey struct {
+	peer      string
+	dscp      string
+	source    string
+	protocol  string
+	direction string
+}
+
+// smoothed keeps the exponentially weighted moving averages of the latencies.
+type smoothed struct {
+	alpha float64
+
+	averages map[latencyKey]float64
+	mx       sync.Mutex
+}
+
+func newSmoothed(alpha float64) *smoothed {
+	return &smoothed{
+		alpha:    alpha,
+		averages: make(map[latencyKey]float64),
+	}
+}
+
+// update mixes the latency into the moving average, and returns the result.
+func (s *smoothed) update(key latencyKey, latency float64) float64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	average, exists := s.averages[key]
+	if !exists { // start from the first sample, not from zero
+		average = latency
+	} else {
+		average += s.alpha * (latency - average)
+	}
+	s.averages[key] = average
+	return average
+}
+
+// observeLatency feeds the latency measurement (in microseconds) into all of
+// the latency metrics beyond the histograms.
+func (s *Server) observeLatency(ctx context.Context, key latencyKey, latency float64, attrs ...otelattr.KeyValue) {
+	s.quantiles.observe(key, latency)
+
+	average := s.smoothed.update(key, latency)
+
+	var last, smoothed otelapi.Float64Gauge
+	switch key.direction {
+	case directionForward:
+		last, smoothed = metrics.GaugeLastForwardTripLatency, metrics.GaugeSmoothedForwardTripLatency
+	case directionReturn:
+		last, smoothed = metrics.GaugeLastReturnTripLatency, metrics.GaugeSmoothedReturnTripLatency
+	case directionRoundTrip:
+		last, smoothed = metrics.GaugeLastRoundTripLatency, metrics.GaugeSmoothedRoundTripLatency
+	default:
+		return
+	}
+	last.Record(ctx, latency, s.labels, otelapi.WithAttributes(attrs...))
+	smoothed.Record(ctx, average, s.labels, otelapi.WithAttributes(attrs...))
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	otelattr "go.opentelemetry.io/otel/attribute"
+)
+
+func TestLatencyGauges(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Metrics.LatencyEWMAAlpha = 0.5
+	s, _ := newTestServer(t, cfg)
+
+	key := latencyKey{"ewma-peer", "0", "", protocolUDP, directionRoundTrip}
+	for _, latency := range []float64{100, 300, 200} { // ewma: 100, 200, 200
+		s.observeLatency(context.Background(), key, latency,
+			otelattr.String("peer", key.peer),
+			otelattr.String("protocol", key.protocol),
+		)
+	}
+
+	require.Equal(t, []float64{200}, gaugeValues(t, "latency_monitor_last_round_trip_latency_microseconds", "ewma-peer"))
+	require.Equal(t, []float64{200}, gaugeValues(t, "latency_monitor_smoothed_round_trip_latency_microseconds", "ewma-peer"))
+	require.Empty(t, gaugeValues(t, "latency_monitor_last_forward_trip_latency_microseconds", "ewma-peer"))
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/traceroute"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownPeer = errors.New("unknown peer")
+)
+
+// peerPath is the latest discovered path towards the peer.
+type peerPath struct {
+	Peer string `json:"peer"`
+	*traceroute.Path
+}
+
+// discoverPath discovers the path towards the peer, and reports (and logs)
+// whether it has changed since the last discovery.
+func (s *Server) discoverPath(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer) (*traceroute.Path, error) {
+	l := logutils.LoggerFromContext(ctx)
+
+	addr, err := peer.UDPAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	// the same source port as of the probes (the destination one can not be
+	// the same, since the peer listens on it)
+	sourcePort := 0
+	if peer.Kind() == types.PeerKindUDP {
+		if t, err := s.sender(peer, addr); err == nil && t.LocalAddr() != nil {
+			sourcePort = t.LocalAddr().Port
+		}
+	}
+
+	path, err := traceroute.Trace(ctx, addr.IP, traceroute.Options{
+		Source:     peer.Source().IP,
+		Device:     peer.Source().Device,
+		SourcePort: sourcePort,
+		MaxHops:    s.cfg.PathDiscovery.MaxHops,
+		Timeout:    s.cfg.PathDiscovery.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.GaugePathHopCount.Record(ctx, int64(path.HopCount()), s.labels, otelapi.WithAttributes(
+		otelattr.String("peer", peer.Name()),
+	))
+
+	s.pathsMx.Lock()
+	previous := s.paths[peerUUID]
+	s.paths[peerUUID] = path
+	s.pathsMx.Unlock()
+
+	if previous != nil && !previous.Equal(path) {
+		metrics.CounterPathChange.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("peer", peer.Name()),
+		))
+		l.Info("Path towards the peer has changed",
+			zap.String("peer", peer.Name()),
+			zap.String("previous_path", previous.String()),
+			zap.String("path", path.String()),
+		)
+	}
+
+	return path, nil
+}
+
+// discoverPaths periodically discovers the paths towards all of the peers.
+func (s *Server) discoverPaths(ctx context.Context, ticker *time.Ticker) {
+	l := logutils.LoggerFromContext(ctx)
+
+	for {
+		for peerUUID, peer := range s.peers {
+			if _, err := s.discoverPath(ctx, peerUUID, peer); err != nil {
+				l.Warn("Failed to discover the path towards the peer",
+					zap.Error(err),
+					zap.String("peer", peer.Name()),
+				)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+func (s *Server) handleGetPaths(w http.ResponseWriter, r *http.Request) {
+	s.pathsMx.Lock()
+	paths := make([]peerPath, 0, len(s.paths))
+	for peerUUID, path := range s.paths {
+		paths = append(paths, peerPath{Peer: s.peers[peerUUID].Name(), Path: path})
+	}
+	s.pathsMx.Unlock()
+
+	slices.SortFunc(paths, func(a, b peerPath) int {
+		return strings.Compare(a.Peer, b.Peer)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(paths)
+}
+
+// handleDiscoverPath discovers the path towards the peer right away.
+func (s *Server) handleDiscoverPath(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("peer")
+	for peerUUID, peer := range s.peers {
+		if peer.Name() != name {
+			continue
+		}
+
+		path, err := s.discoverPath(r.Context(), peerUUID, peer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(peerPath{Peer: name, Path: path})
+		return
+	}
+
+	http.Error(w, ErrUnknownPeer.Error()+": "+name, http.StatusNotFound)
+}
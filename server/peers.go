@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+// peerState is what we have learned about the peer from its returns.
+type peerState struct {
+	lastSeen time.Time
+	location string // as reported by the peer (latency-monitors only)
+}
+
+// markSeen records that the probe has returned from the peer just now.
+func (s *Server) markSeen(peerUUID uuid.UUID, location string) {
+	s.seenMx.Lock()
+	defer s.seenMx.Unlock()
+
+	state, exists := s.seen[peerUUID]
+	if !exists {
+		state = &peerState{}
+		s.seen[peerUUID] = state
+	}
+	state.lastSeen = time.Now()
+	if location != "" {
+		state.location = location
+	}
+}
+
+// reportPeers is the callback that reports the peers' reachability (and
+// their metadata).  The peer is up if it has returned a probe within the
+// configured number of the probing intervals.
+func (s *Server) reportPeers(_ context.Context, o otelapi.Observer) error {
+	now := time.Now()
+	upWithin := time.Duration(s.cfg.Metrics.PeerUpIntervals) * s.cfg.Transponder.Interval
+
+	s.seenMx.Lock()
+	defer s.seenMx.Unlock()
+
+	for peerUUID, peer := range s.peers {
+		attrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+			otelattr.String("source", peer.Source().String()),
+		}
+
+		state := s.seen[peerUUID]
+
+		up := int64(0)
+		if state != nil && now.Sub(state.lastSeen) <= upWithin {
+			up = 1
+		}
+		o.ObserveInt64(metrics.GaugePeerUp, up, s.labels, otelapi.WithAttributes(attrs...))
+
+		location := ""
+		if state != nil {
+			o.ObserveFloat64(metrics.GaugePeerLastSeen, float64(state.lastSeen.UnixMilli())/1000, s.labels, otelapi.WithAttributes(attrs...))
+			location = state.location
+		}
+
+		o.ObserveInt64(metrics.GaugePeerInfo, 1, s.labels, otelapi.WithAttributes(append(attrs,
+			otelattr.String("kind", peer.Kind()),
+			otelattr.String("address", peer.Address()),
+			otelattr.String("location", location),
+		)...))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeValues(t *testing.T, name, peer string) []float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	res := []float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "peer" && label.GetValue() == peer {
+					res = append(res, m.GetGauge().GetValue())
+				}
+			}
+		}
+	}
+	return res
+}
+
+func TestPeerUp(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Metrics.PeerUpIntervals = 3
+	cfg.Transponder.Interval = time.Minute
+	s, _ := newTestServer(t, cfg)
+
+	seenPeer, err := types.NewPeer("seen-peer=127.0.0.1:32123")
+	require.NoError(t, err)
+	silentPeer, err := types.NewPeer("silent-peer=icmp://127.0.0.2")
+	require.NoError(t, err)
+	seenUUID := uuid.New()
+	s.peers = map[uuid.UUID]*types.Peer{
+		seenUUID:   &seenPeer,
+		uuid.New(): &silentPeer,
+	}
+
+	registration, err := metrics.RegisterCallback(s.reportPeers,
+		metrics.GaugePeerInfo, metrics.GaugePeerLastSeen, metrics.GaugePeerUp,
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = registration.Unregister()
+	})
+
+	s.markSeen(seenUUID, "test")
+
+	require.Equal(t, []float64{1}, gaugeValues(t, "latency_monitor_peer_up", "seen-peer"))
+	require.Equal(t, []float64{0}, gaugeValues(t, "latency_monitor_peer_up", "silent-peer"))
+	require.Len(t, gaugeValues(t, "latency_monitor_peer_last_seen_timestamp_seconds", "seen-peer"), 1)
+	require.Empty(t, gaugeValues(t, "latency_monitor_peer_last_seen_timestamp_seconds", "silent-peer"))
+	require.Equal(t, []float64{1}, gaugeValues(t, "latency_monitor_peer_info", "silent-peer"))
+
+	s.seen[seenUUID].lastSeen = time.Now().Add(-4 * time.Minute)
+	require.Equal(t, []float64{0}, gaugeValues(t, "latency_monitor_peer_up", "seen-peer"))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"strconv"
 
 	"time"
 
@@ -23,10 +24,15 @@ var (
 	ErrUnexpectedSrcDstUUIDs     = errors.New("source uuid is not us, but non-zero destination uuid")
 )
 
-func (s *Server) sendProbes(ctx context.Context, t *transponder.Transponder) {
+func (s *Server) sendProbes(ctx context.Context) {
 	l := logutils.LoggerFromContext(ctx)
 
 	for peerUUID, peer := range s.peers {
+		if peer.Kind() == types.PeerKindHTTP { // resolving is part of the measurement
+			s.sendHTTPRequest(ctx, s.httpClients[peerUUID], peerUUID, peer)
+			continue
+		}
+
 		addr, err := peer.UDPAddress()
 		if err != nil {
 			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
@@ -39,10 +45,49 @@ func (s *Server) sendProbes(ctx context.Context, t *transponder.Transponder) {
 			continue
 		}
 
+		s.allowlist.addPeer(addr.IP)
+
+		switch peer.Kind() {
+		case types.PeerKindICMP:
+			s.sendEchoRequest(ctx, peerUUID, peer, addr.IP)
+			continue
+		case types.PeerKindQUIC:
+			s.sendQUICProbe(ctx, peerUUID, peer)
+			continue
+		case types.PeerKindTCP:
+			s.sendTCPConnect(ctx, peerUUID, peer, addr)
+			continue
+		case types.PeerKindTCPStream:
+			s.sendConnProbe(ctx, peerUUID, peer, protocolTCPStream, s.streams[peerUUID])
+			continue
+		case types.PeerKindTWAMP:
+			s.sendTWAMPProbe(ctx, peerUUID, peer, addr)
+			continue
+		}
+
+		t, err := s.sender(peer, addr)
+		if err != nil {
+			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+			))
+			l.Error("Failed to send a probe",
+				zap.Error(err),
+				zap.String("peer", peer.Name()),
+			)
+			continue
+		}
+		if !t.IsRunning() {
+			l.Warn("Transponder is not running...",
+				zap.String("responder_listen_address", t.Name()),
+			)
+			continue
+		}
+
 		p := types.Probe{
 			Sequence:    peer.Sequence(),
 			SrcUUID:     s.uuid,
 			SrcLocation: s.location,
+			SrcDSCP:     peer.DSCP(),
 			DstUUID:     peerUUID,
 		}
 		p.SrcTimestamp = time.Now()
@@ -58,7 +103,7 @@ func (s *Server) sendProbes(ctx context.Context, t *transponder.Transponder) {
 			continue
 		}
 
-		t.Send(b, addr, func(err error) {
+		t.Send(b, addr, peer.DSCP(), func(err error) {
 			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
 				otelattr.String("error_type", reflect.TypeOf(err).String()),
 			))
@@ -67,9 +112,14 @@ func (s *Server) sendProbes(ctx context.Context, t *transponder.Transponder) {
 			)
 		})
 
-		metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+		sentAttrs := []otelattr.KeyValue{
 			otelattr.String("peer", peer.Name()),
-		))
+			otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+			otelattr.String("source", peer.Source().String()),
+			otelattr.String("protocol", protocolUDP),
+		}
+		metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(sentAttrs...))
+		s.statsd.Count("probe_sent_count", 1, sentAttrs...)
 		l.Debug("Sent a probe",
 			zap.String("name", peer.Name()),
 		)
@@ -77,102 +127,250 @@ func (s *Server) sendProbes(ctx context.Context, t *transponder.Transponder) {
 }
 
 func (s *Server) receiveProbes(ctx context.Context) transponder.Receive {
+	return func(t *transponder.Transponder, input []byte, source *net.UDPAddr, meta transponder.Metadata) {
+		s.handleProbe(ctx, protocolUDP, t.Name(), input, source, meta.DSCP, func(output []byte, dscp uint8, onError func(error)) {
+			t.Reply(meta, output, source, dscp, onError)
+		})
+	}
+}
+
+// handleProbe handles the probe received over any of the protocols that carry
+// them (with the dscp it was received with, if known).  The reply to the
+// others' probes is passed to respond along with the dscp to mark it with.
+func (s *Server) handleProbe(
+	ctx context.Context,
+	protocol, listener string,
+	input []byte,
+	source net.Addr,
+	receivedDSCP uint8,
+	respond func(output []byte, dscp uint8, onError func(error)),
+) {
 	l := logutils.LoggerFromContext(ctx)
+	ts := time.Now()
+	sourceIP := addrIP(source)
 
-	return func(t *transponder.Transponder, input []byte, source *net.UDPAddr) {
-		ts := time.Now()
+	if allowed, reason := s.allowlist.allow(sourceIP); !allowed {
+		metrics.CounterProbeRejected.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("reason", reason),
+			otelattr.String("listener", listener),
+		))
+		l.Debug("Rejected a probe",
+			zap.String("reason", reason),
+			zap.String("source", source.String()),
+		)
+		return
+	}
 
-		p := types.Probe{}
-		if err := p.UnmarshalBinary(input); err != nil {
-			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
-				otelattr.String("error_type", reflect.TypeOf(err).String()),
+	p := types.Probe{}
+	if err := p.UnmarshalBinary(input); err != nil {
+		metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+			otelattr.String("listener", listener),
+		))
+		l.Error("Invalid probe",
+			zap.Error(err),
+			zap.String("source", source.String()),
+			zap.ByteString("payload", input),
+		)
+		return
+	}
+
+	switch {
+	case p.DstTimestamp.IsZero(): // reply to the others' probes
+		if !s.cfg.Transponder.Responds() {
+			metrics.CounterProbeRejected.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("reason", rejectReasonMode),
+				otelattr.String("listener", listener),
 			))
-			l.Error("Invalid probe",
-				zap.Error(err),
+			l.Debug("Rejected a probe",
+				zap.String("reason", rejectReasonMode),
 				zap.String("source", source.String()),
-				zap.ByteString("payload", input),
 			)
 			return
 		}
 
-		switch {
-		case p.DstTimestamp.IsZero(): // reply to the others' probes
-			p.DstTimestamp = ts
-			p.DstLocation = s.location
-			output, err := p.MarshalBinary()
-			if err != nil {
-				metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
-					otelattr.String("error_type", reflect.TypeOf(err).String()),
-				))
-				l.Error("Failed to prepare response to a probe",
-					zap.Error(err),
-				)
-				return
-			}
-
-			go func() {
-				t.Send(output, source, func(err error) {
-					metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
-						otelattr.String("error_type", reflect.TypeOf(err).String()),
-					))
-					l.Error("Failed to respond to a probe",
-						zap.Error(err),
-					)
-				})
-			}()
-
-		case p.SrcUUID == s.uuid: // handle our own (returned) probes
-			peer, known := s.peers[p.DstUUID]
-			if !known {
-				err := fmt.Errorf("%w: %s",
-					ErrUnexpectedDstUUIDOnReturn, p.DstUUID.String(),
-				)
-				metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
-					otelattr.String("error_type", reflect.TypeOf(err).String()),
-				))
-				l.Error("Invalid return probe",
-					zap.Error(err),
-					zap.String("source", source.String()),
-				)
-				return
-			}
-
-			forwardLatency := float64(p.DstTimestamp.Sub(p.SrcTimestamp).Microseconds())
-			metrics.HistogramLatencyForwardTrip.Record(ctx, forwardLatency, s.labels, otelapi.WithAttributes(
-				otelattr.String("peer", peer.Name()),
-				otelattr.String("from", p.SrcLocation.String()),
-				otelattr.String("to", p.DstLocation.String()),
+		receivedAttrs := []otelattr.KeyValue{
+			otelattr.String("from", s.locations.value(ctx, "probe_received_count", "from", p.SrcLocation.String())),
+			otelattr.String("dscp", formatDSCP(p.SrcDSCP)),
+			otelattr.String("listener", listener),
+			otelattr.String("protocol", protocol),
+		}
+		metrics.CountProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(receivedAttrs...))
+		s.statsd.Count("probe_received_count", 1, receivedAttrs...)
+
+		inboundLatency := float64(ts.Sub(p.SrcTimestamp).Microseconds())
+		metrics.HistogramLatencyInboundForwardTrip.Record(ctx, inboundLatency, s.labels, otelapi.WithAttributes(receivedAttrs...))
+		s.statsd.Timing("inbound_forward_trip_latency", inboundLatency, receivedAttrs...)
+
+		if allowed, reason := s.limiter.Allow(sourceIP, ts); !allowed {
+			metrics.CounterProbeReplyThrottled.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("reason", reason),
+				otelattr.String("listener", listener),
 			))
+			l.Debug("Throttled reply to a probe",
+				zap.String("reason", reason),
+				zap.String("source", source.String()),
+			)
+			return
+		}
 
-			returnLatency := float64(ts.Sub(p.DstTimestamp).Microseconds())
-			metrics.HistogramLatencyReturnTrip.Record(ctx, returnLatency, s.labels, otelapi.WithAttributes(
-				otelattr.String("peer", peer.Name()),
-				otelattr.String("to", p.SrcLocation.String()),
-				otelattr.String("from", p.DstLocation.String()),
+		p.DstTimestamp = ts
+		p.DstLocation = s.location
+		p.DstDSCP = receivedDSCP
+		output, err := p.MarshalBinary()
+		if err != nil {
+			metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", listener),
 			))
+			l.Error("Failed to prepare response to a probe",
+				zap.Error(err),
+			)
+			return
+		}
+		if len(input) < len(output) { // the peer predates the dscp
+			output = output[:len(input)]
+		}
 
-			metrics.CountProbeReturned.Add(ctx, 1, s.labels, otelapi.WithAttributes(
-				otelattr.String("peer", peer.Name()),
+		respond(output, p.SrcDSCP, func(err error) { // reply within the same class
+			metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", listener),
 			))
-			l.Debug("Received a return probe",
-				zap.Float64("forward_latency_ms", forwardLatency),
-				zap.Float64("return_latency_ms", returnLatency),
-				zap.String("name", peer.Name()),
+			l.Error("Failed to respond to a probe",
+				zap.Error(err),
 			)
+		})
 
-			return
+		respondedAttrs := []otelattr.KeyValue{
+			otelattr.String("listener", listener),
+			otelattr.String("protocol", protocol),
+		}
+		metrics.CountProbeResponded.Add(ctx, 1, s.labels, otelapi.WithAttributes(respondedAttrs...))
+		s.statsd.Count("probe_responded_count", 1, respondedAttrs...)
 
-		default: // handle mismatching probes
-			err := fmt.Errorf("%w: source %s, destination %s",
-				ErrUnexpectedSrcDstUUIDs, p.SrcUUID.String(), p.DstUUID.String(),
+	case p.SrcUUID == s.uuid: // handle our own (returned) probes
+		peer, known := s.peers[p.DstUUID]
+		if !known {
+			err := fmt.Errorf("%w: %s",
+				ErrUnexpectedDstUUIDOnReturn, p.DstUUID.String(),
 			)
 			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
 				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", listener),
 			))
-			l.Error("Invalid probe",
+			l.Error("Invalid return probe",
 				zap.Error(err),
+				zap.String("source", source.String()),
 			)
 			return
 		}
+
+		dscp := formatDSCP(p.SrcDSCP)
+		peerSource := peer.Source().String()
+		latency := metrics.Latency(peer.BucketProfile())
+		exemplarCtx := metrics.ContextWithExemplar(ctx)
+		exemplarAttrs := otelapi.WithAttributes(metrics.ExemplarAttributes(p.Sequence, p.SrcTimestamp, p.DstTimestamp)...)
+
+		forwardLatency := float64(p.DstTimestamp.Sub(p.SrcTimestamp).Microseconds())
+		forwardAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("from", s.locations.value(ctx, "forward_trip_latency", "from", p.SrcLocation.String())),
+			otelattr.String("to", s.locations.value(ctx, "forward_trip_latency", "to", p.DstLocation.String())),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocol),
+		}
+		latency.ForwardTrip.Record(exemplarCtx, forwardLatency, s.labels, otelapi.WithAttributes(forwardAttrs...), exemplarAttrs)
+		s.statsd.Timing("forward_trip_latency", forwardLatency, forwardAttrs...)
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocol, directionForward}, forwardLatency, forwardAttrs...)
+
+		returnLatency := float64(ts.Sub(p.DstTimestamp).Microseconds())
+		returnAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("to", s.locations.value(ctx, "return_trip_latency", "to", p.SrcLocation.String())),
+			otelattr.String("from", s.locations.value(ctx, "return_trip_latency", "from", p.DstLocation.String())),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocol),
+		}
+		latency.ReturnTrip.Record(exemplarCtx, returnLatency, s.labels, otelapi.WithAttributes(returnAttrs...), exemplarAttrs)
+		s.statsd.Timing("return_trip_latency", returnLatency, returnAttrs...)
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocol, directionReturn}, returnLatency, returnAttrs...)
+
+		roundTripLatency := float64(ts.Sub(p.SrcTimestamp).Microseconds())
+		roundTripAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocol),
+		}
+		latency.RoundTrip.Record(ctx, roundTripLatency, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.statsd.Timing("round_trip_latency", roundTripLatency, roundTripAttrs...)
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocol, directionRoundTrip}, roundTripLatency, roundTripAttrs...)
+
+		if p.DstDSCP != types.DSCPUnknown && p.DstDSCP != p.SrcDSCP {
+			metrics.CounterDSCPRemarked.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("dscp", dscp),
+				otelattr.String("source", peerSource),
+				otelattr.String("direction", "forward"),
+				otelattr.String("remarked_dscp", strconv.Itoa(int(p.DstDSCP))),
+			))
+		}
+		if receivedDSCP != types.DSCPUnknown && receivedDSCP != p.SrcDSCP {
+			metrics.CounterDSCPRemarked.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("dscp", dscp),
+				otelattr.String("source", peerSource),
+				otelattr.String("direction", "return"),
+				otelattr.String("remarked_dscp", strconv.Itoa(int(receivedDSCP))),
+			))
+		}
+
+		metrics.CountProbeReturned.Add(ctx, 1, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.markSeen(p.DstUUID, s.locations.value(ctx, "peer_info", "location", p.DstLocation.String()))
+		s.statsd.Count("probe_returned_count", 1, roundTripAttrs...)
+		l.Debug("Received a return probe",
+			zap.Float64("forward_latency_ms", forwardLatency),
+			zap.Float64("return_latency_ms", returnLatency),
+			zap.Float64("round_trip_latency_ms", roundTripLatency),
+			zap.String("name", peer.Name()),
+		)
+
+		return
+
+	default: // handle mismatching probes
+		err := fmt.Errorf("%w: source %s, destination %s",
+			ErrUnexpectedSrcDstUUIDs, p.SrcUUID.String(), p.DstUUID.String(),
+		)
+		metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+			otelattr.String("listener", listener),
+		))
+		l.Error("Invalid probe",
+			zap.Error(err),
+		)
+		return
+	}
+}
+
+// addrIP returns the ip of the udp or tcp address.
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
+}
+
+// formatDSCP formats the dscp for the labels.
+func formatDSCP(dscp uint8) string {
+	if dscp == types.DSCPUnknown {
+		return "unknown"
 	}
+	return strconv.Itoa(int(dscp))
 }
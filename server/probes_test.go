@@ -0,0 +1,383 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+var setupMetrics = sync.OnceValue(func() error { // metrics are global
+	return metrics.Setup(context.Background(), &config.Metrics{
+		Exemplars:             true,
+		LatencyBucketProfiles: map[string][]float64{"metro": {100, 250, 500, 1000}},
+		LatencyBucketsCount:   33,
+		MaxLatencyUs:          1000000,
+	})
+})
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Metrics: config.Metrics{
+			LatencyBucketsCount: 33,
+			LatencyEWMAAlpha:    0.1,
+			Location:            "test",
+			MaxLatencyUs:        1000000,
+		},
+		Transponder: config.Transponder{
+			BatchSize:    32,
+			Mode:         config.ModeBoth,
+			ReplyWorkers: 1,
+			Sockets:      1,
+		},
+	}
+}
+
+// newTestServer returns the server along with the running transponder that
+// has the server's probe handler plugged in.
+func newTestServer(t *testing.T, cfg *config.Config) (*Server, *transponder.Transponder) {
+	require.NoError(t, setupMetrics())
+
+	s, err := New(cfg)
+	require.NoError(t, err)
+
+	tr, err := transponder.New(&cfg.Transponder, "127.0.0.1:0")
+	require.NoError(t, err)
+	tr.Receive = s.receiveProbes(context.Background())
+
+	go func() {
+		_ = tr.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = tr.Shutdown(context.Background())
+	})
+	require.Eventually(t, tr.IsRunning, time.Second, time.Millisecond)
+
+	return s, tr
+}
+
+// newSink returns a udp socket on the loopback that counts the datagrams it
+// receives.
+func newSink(t *testing.T) (*net.UDPAddr, func() int) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn.LocalAddr().(*net.UDPAddr), func() int {
+		count := 0
+		buf := make([]byte, types.ProbeSize())
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, _, err := conn.ReadFromUDP(buf); err != nil {
+				return count
+			}
+			count++
+		}
+	}
+}
+
+func syntheticProbe(t *testing.T) []byte {
+	p := types.Probe{
+		Sequence:     1,
+		SrcUUID:      uuid.New(),
+		SrcTimestamp: time.Now(),
+		DstUUID:      uuid.New(),
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	res := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if v, ok := labels[label.GetName()]; ok && v != label.GetValue() {
+					continue metrics
+				}
+			}
+			res += m.GetCounter().GetValue()
+		}
+	}
+	return res
+}
+
+func histogramCount(t *testing.T, name string, labels map[string]string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	res := uint64(0)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if v, ok := labels[label.GetName()]; ok && v != label.GetValue() {
+					continue metrics
+				}
+			}
+			res += m.GetHistogram().GetSampleCount()
+		}
+	}
+	return res
+}
+
+func TestReplyThrottledPerSource(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Responder.RateLimitPerSource = 1
+	cfg.Responder.RateLimitPerSourceBurst = 5
+
+	s, tr := newTestServer(t, cfg)
+	handle := s.receiveProbes(context.Background())
+	sink, countReplies := newSink(t)
+
+	labels := map[string]string{"reason": "source", "listener": tr.Name()}
+	throttledBefore := counterValue(t, "latency_monitor_probe_reply_throttled_count_total", labels)
+
+	for i := 0; i < 50; i++ {
+		handle(tr, syntheticProbe(t), sink, transponder.Metadata{})
+	}
+
+	throttled := counterValue(t, "latency_monitor_probe_reply_throttled_count_total", labels) - throttledBefore
+	replied := countReplies()
+
+	require.Equal(t, 5, replied)
+	require.Equal(t, 45.0, throttled)
+}
+
+func TestReplyThrottledGlobally(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Responder.RateLimitGlobal = 1
+	cfg.Responder.RateLimitGlobalBurst = 10
+	cfg.Responder.RateLimitPerSource = 1
+	cfg.Responder.RateLimitPerSourceBurst = 5
+
+	s, tr := newTestServer(t, cfg)
+	handle := s.receiveProbes(context.Background())
+
+	labels := map[string]string{"reason": "global", "listener": tr.Name()}
+	throttledBefore := counterValue(t, "latency_monitor_probe_reply_throttled_count_total", labels)
+
+	for i := 0; i < 100; i++ { // spoofed sources
+		handle(tr, syntheticProbe(t), &net.UDPAddr{
+			IP:   net.IPv4(127, 0, 1, byte(i)),
+			Port: 9,
+		}, transponder.Metadata{})
+	}
+
+	throttled := counterValue(t, "latency_monitor_probe_reply_throttled_count_total", labels) - throttledBefore
+	require.Equal(t, 90.0, throttled)
+}
+
+func TestProbeRejected(t *testing.T) {
+	_, network, err := net.ParseCIDR("127.0.0.0/24")
+	require.NoError(t, err)
+	peer, err := types.NewPeer("peer=127.0.0.1:32123")
+	require.NoError(t, err)
+
+	cfg := newTestConfig()
+	cfg.Responder.AllowedNetworks = []*net.IPNet{network}
+	cfg.Responder.AllowPeersOnly = true
+	cfg.Transponder.Peers = []types.Peer{peer}
+
+	s, tr := newTestServer(t, cfg)
+	handle := s.receiveProbes(context.Background())
+	sink, countReplies := newSink(t)
+
+	byNetwork := map[string]string{"reason": "network", "listener": tr.Name()}
+	byPeer := map[string]string{"reason": "peer", "listener": tr.Name()}
+	byNetworkBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", byNetwork)
+	byPeerBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", byPeer)
+
+	handle(tr, syntheticProbe(t), sink, transponder.Metadata{}) // peer's address
+	handle(tr, syntheticProbe(t), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 9}, transponder.Metadata{})
+	handle(tr, syntheticProbe(t), &net.UDPAddr{IP: net.IPv4(127, 0, 1, 1), Port: 9}, transponder.Metadata{})
+
+	require.Equal(t, 1, countReplies())
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_probe_rejected_count_total", byNetwork)-byNetworkBefore)
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_probe_rejected_count_total", byPeer)-byPeerBefore)
+}
+
+func TestInitiatorDoesNotRespond(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.Mode = config.ModeInitiator
+
+	s, tr := newTestServer(t, cfg)
+	handle := s.receiveProbes(context.Background())
+	sink, countReplies := newSink(t)
+
+	labels := map[string]string{"reason": "mode", "listener": tr.Name()}
+	rejectedBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", labels)
+
+	handle(tr, syntheticProbe(t), sink, transponder.Metadata{})
+
+	require.Equal(t, 0, countReplies())
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_probe_rejected_count_total", labels)-rejectedBefore)
+}
+
+func TestLatencyBucketProfile(t *testing.T) {
+	peer, err := types.NewPeer("metro-peer=127.0.0.1:32123;buckets=metro")
+	require.NoError(t, err)
+
+	s, tr := newTestServer(t, newTestConfig())
+	peerUUID := uuid.New()
+	s.peers = map[uuid.UUID]*types.Peer{peerUUID: &peer}
+
+	p := types.Probe{
+		Sequence:     1,
+		SrcUUID:      s.uuid,
+		SrcTimestamp: time.Now().Add(-time.Millisecond),
+		DstUUID:      peerUUID,
+		DstTimestamp: time.Now(),
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	s.receiveProbes(context.Background())(tr, b, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 32123}, transponder.Metadata{})
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "latency_monitor_round_trip_latency_microseconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() != "peer" || label.GetValue() != "metro-peer" {
+					continue
+				}
+				bounds := []float64{}
+				for _, bucket := range m.GetHistogram().GetBucket() {
+					bounds = append(bounds, bucket.GetUpperBound())
+				}
+				require.Equal(t, []float64{100, 250, 500, 1000}, bounds)
+				return
+			}
+		}
+	}
+	require.Fail(t, "round trip latency of the peer is missing")
+}
+
+func TestInboundProbes(t *testing.T) {
+	s, tr := newTestServer(t, newTestConfig())
+	handle := s.receiveProbes(context.Background())
+	sink, countReplies := newSink(t)
+
+	location := types.Location{}
+	copy(location[:], "inbound-peer")
+	p := types.Probe{
+		Sequence:     1,
+		SrcUUID:      uuid.New(),
+		SrcLocation:  location,
+		SrcTimestamp: time.Now().Add(-time.Millisecond),
+		DstUUID:      uuid.New(),
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	labels := map[string]string{"from": "inbound-peer", "listener": tr.Name()}
+	for i := 0; i < 3; i++ {
+		handle(tr, b, sink, transponder.Metadata{})
+	}
+
+	require.Equal(t, 3, countReplies())
+	require.Equal(t, 3.0, counterValue(t, "latency_monitor_probe_received_count_total", labels))
+	require.Equal(t, uint64(3), histogramCount(t, "latency_monitor_inbound_forward_trip_latency_microseconds", labels))
+}
+
+func TestLatencyExemplars(t *testing.T) {
+	peer, err := types.NewPeer("exemplar-peer=127.0.0.1:32123")
+	require.NoError(t, err)
+
+	s, tr := newTestServer(t, newTestConfig())
+	peerUUID := uuid.New()
+	s.peers = map[uuid.UUID]*types.Peer{peerUUID: &peer}
+
+	p := types.Probe{
+		Sequence:     42,
+		SrcUUID:      s.uuid,
+		SrcTimestamp: time.Now().Add(-time.Millisecond),
+		DstUUID:      peerUUID,
+		DstTimestamp: time.Now(),
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	s.receiveProbes(context.Background())(tr, b, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 32123}, transponder.Metadata{})
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "latency_monitor_forward_trip_latency_microseconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["peer"] != "exemplar-peer" {
+				continue
+			}
+			require.NotContains(t, labels, "seq") // not a label of the series
+
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				if bucket.GetExemplar() == nil {
+					continue
+				}
+				exemplar := map[string]string{}
+				for _, label := range bucket.GetExemplar().GetLabel() {
+					exemplar[label.GetName()] = label.GetValue()
+				}
+				require.Equal(t, "42", exemplar["seq"])
+				require.Equal(t, strconv.FormatInt(p.SrcTimestamp.UnixMicro(), 10), exemplar["src_ts"])
+				require.Equal(t, strconv.FormatInt(p.DstTimestamp.UnixMicro(), 10), exemplar["dst_ts"])
+				return
+			}
+		}
+	}
+	require.Fail(t, "forward trip latency exemplar of the peer is missing")
+}
+
+func TestReplyToLegacyProbe(t *testing.T) {
+	s, tr := newTestServer(t, newTestConfig())
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	probe := syntheticProbe(t)[:types.LegacyProbeSize()]
+	s.receiveProbes(context.Background())(tr, probe, conn.LocalAddr().(*net.UDPAddr), transponder.Metadata{})
+
+	buf := make([]byte, types.ProbeSize())
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFromUDP(buf)
+	require.NoError(t, err)
+	require.Equal(t, types.LegacyProbeSize(), n) // the legacy peer would reject the larger one
+
+	reply := types.Probe{}
+	require.NoError(t, reply.UnmarshalBinary(buf[:n]))
+	require.False(t, reply.DstTimestamp.IsZero())
+}
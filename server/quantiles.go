@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/sketch"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+// quantiles keeps the sliding-window sketches of the latencies, and reports
+// the estimates of their quantiles when the metrics are collected.
+type quantiles struct {
+	cfg *config.Metrics
+
+	windows map[latencyKey][]*sketch.Window // per configured window
+	mx      sync.Mutex
+}
+
+func newQuantiles(cfg *config.Metrics) *quantiles {
+	return &quantiles{
+		cfg:     cfg,
+		windows: make(map[latencyKey][]*sketch.Window),
+	}
+}
+
+// observe adds the latency (in microseconds) into the sketches.  The nil
+// quantiles (i.e. disabled ones) observe nothing.
+func (q *quantiles) observe(key latencyKey, latency float64) {
+	if q == nil {
+		return
+	}
+
+	now := time.Now()
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	windows, exist := q.windows[key]
+	if !exist {
+		windows = make([]*sketch.Window, 0, len(q.cfg.QuantileWindows))
+		for _, length := range q.cfg.QuantileWindows {
+			windows = append(windows, sketch.NewWindow(length, q.cfg.QuantileAccuracy))
+		}
+		q.windows[key] = windows
+	}
+	for _, w := range windows {
+		w.Add(latency, now)
+	}
+}
+
+// report is the callback that reports the quantiles estimates.
+func (q *quantiles) report(labels otelapi.MeasurementOption) otelapi.Callback {
+	return func(_ context.Context, o otelapi.Observer) error {
+		now := time.Now()
+
+		q.mx.Lock()
+		defer q.mx.Unlock()
+
+		for key, windows := range q.windows {
+			for i, w := range windows {
+				s := w.Sketch(now)
+				if s.Count() == 0 {
+					continue
+				}
+				window := formatWindow(q.cfg.QuantileWindows[i])
+				for _, quantile := range q.cfg.Quantiles {
+					value, _ := s.Quantile(quantile)
+					o.ObserveFloat64(metrics.GaugeLatencyQuantile, value, labels, otelapi.WithAttributes(
+						otelattr.String("peer", key.peer),
+						otelattr.String("dscp", key.dscp),
+						otelattr.String("source", key.source),
+						otelattr.String("protocol", key.protocol),
+						otelattr.String("direction", key.direction),
+						otelattr.String("window", window),
+						otelattr.String("quantile", strconv.FormatFloat(quantile, 'f', -1, 64)),
+					))
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// formatWindow formats the window length the way it's usually spelled in the
+// queries (e.g. "5m" rather than "5m0s").
+func formatWindow(length time.Duration) string {
+	res := length.String()
+	if strings.HasSuffix(res, "m0s") {
+		res = strings.TrimSuffix(res, "0s")
+	}
+	if strings.HasSuffix(res, "h0m") {
+		res = strings.TrimSuffix(res, "0m")
+	}
+	return res
+}
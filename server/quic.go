@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+)
+
+const (
+	protocolQUIC = "quic"
+)
+
+// sendQUICProbe sends the probe to the peer in quic datagram, and reports the
+// round-trip time of the connection as estimated by quic.
+func (s *Server) sendQUICProbe(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer) {
+	d := s.quicDialers[peerUUID]
+	if !s.sendConnProbe(ctx, peerUUID, peer, protocolQUIC, d) {
+		return
+	}
+
+	if rtt := d.SmoothedRTT(); rtt > 0 {
+		metrics.GaugeQUICSmoothedRTT.Record(ctx, float64(rtt.Microseconds()), s.labels, otelapi.WithAttributes(
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+			otelattr.String("source", peer.Source().String()),
+			otelattr.String("protocol", protocolQUIC),
+		))
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQUICLoopback(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	free, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenAddress := free.LocalAddr().String()
+	free.Close()
+
+	listener, err := transponder.NewQUICListener(listenAddress)
+	require.NoError(t, err)
+	listener.Receive = s.receiveConn(ctx, protocolQUIC)
+
+	peer, err := types.NewPeer("remote=quic://" + listenAddress)
+	require.NoError(t, err)
+	peerUUID := uuid.New()
+	s.peers = map[uuid.UUID]*types.Peer{peerUUID: &peer}
+
+	dialer := transponder.NewQUICDialer(&peer, cfg.Transponder.ConnectTimeout)
+	dialer.Receive = s.receiveConn(ctx, protocolQUIC)
+	s.quicDialers[peerUUID] = dialer
+
+	for _, r := range []runnable{listener, dialer} {
+		go func() {
+			_ = r.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			_ = r.Shutdown(ctx)
+		})
+	}
+	require.Eventually(t, dialer.IsConnected, 5*time.Second, 10*time.Millisecond)
+
+	labels := map[string]string{"peer": "remote", "protocol": "quic"}
+	returnedBefore := counterValue(t, "latency_monitor_probe_returned_count_total", labels)
+
+	s.sendProbes(ctx)
+
+	require.Eventually(t, func() bool {
+		return counterValue(t, "latency_monitor_probe_returned_count_total", labels)-returnedBefore == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Positive(t, dialer.SmoothedRTT())
+}
+
+func TestQUICListenerRejects(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	cfg.Transponder.Mode = config.ModeInitiator
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	free, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenAddress := free.LocalAddr().String()
+	free.Close()
+
+	listener, err := transponder.NewQUICListener(listenAddress)
+	require.NoError(t, err)
+	listener.Accept = s.acceptConn(ctx, listenAddress)
+	listener.Receive = s.receiveConn(ctx, protocolQUIC)
+
+	peer, err := types.NewPeer("remote=quic://" + listenAddress)
+	require.NoError(t, err)
+	dialer := transponder.NewQUICDialer(&peer, cfg.Transponder.ConnectTimeout)
+	dialer.Receive = s.receiveConn(ctx, protocolQUIC)
+
+	labels := map[string]string{"reason": rejectReasonMode, "listener": listenAddress}
+	rejectedBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", labels)
+
+	for _, r := range []runnable{listener, dialer} {
+		go func() {
+			_ = r.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			_ = r.Shutdown(ctx)
+		})
+	}
+
+	require.Eventually(t, func() bool {
+		return counterValue(t, "latency_monitor_probe_rejected_count_total", labels)-rejectedBefore >= 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return !dialer.IsConnected() }, time.Second, 10*time.Millisecond)
+}
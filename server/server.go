@@ -3,9 +3,12 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -13,15 +16,31 @@ import (
 	"github.com/flashbots/latency-monitor/httplogger"
 	"github.com/flashbots/latency-monitor/logutils"
 	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/ratelimit"
+	"github.com/flashbots/latency-monitor/statsd"
+	"github.com/flashbots/latency-monitor/traceroute"
 	"github.com/flashbots/latency-monitor/transponder"
 	"github.com/flashbots/latency-monitor/types"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	otelattr "go.opentelemetry.io/otel/attribute"
 	otelapi "go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrNoListenAddresses  = errors.New("at least one transponder listen address is required")
+	ErrNoSuitableListener = errors.New("no transponder listens on the address family of the peer")
+)
+
+// runnable is what the server runs (and shuts down) alongside itself.
+type runnable interface {
+	Name() string
+	Run(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
 type Server struct {
 	cfg *config.Config
 	log *zap.Logger
@@ -29,8 +48,34 @@ type Server struct {
 	uuid  uuid.UUID
 	peers map[uuid.UUID]*types.Peer
 
-	labels   otelapi.MeasurementOption
-	location types.Location
+	transponders []runnable                             // all of the below
+	listeners    []*transponder.Transponder             // bound to the listen addresses
+	sources      map[string]*transponder.Transponder    // bound to the peers' sources
+	twampSenders map[uuid.UUID]*transponder.Transponder // per twamp peer (the returns tell the peer by it)
+	pingers      map[string]*transponder.Pinger         // bound to the icmp peers' sources
+
+	httpClients map[uuid.UUID]*http.Client              // per http peer
+	quicDialers map[uuid.UUID]*transponder.QUICDialer   // per quic peer
+	streams     map[uuid.UUID]*transponder.StreamDialer // per tcp stream peer
+
+	paths   map[uuid.UUID]*traceroute.Path // latest discovered per peer
+	pathsMx sync.Mutex
+
+	seen   map[uuid.UUID]*peerState // per peer that has returned probes
+	seenMx sync.Mutex
+
+	twampReflectors map[uuid.UUID]string // twamp peer => its reflector's address
+	twampMx         sync.RWMutex
+
+	labels    otelapi.MeasurementOption
+	location  types.Location
+	locations *locationLabels
+	statsd    *statsd.Client // nil unless configured
+	quantiles *quantiles     // nil unless configured
+	smoothed  *smoothed
+
+	allowlist *allowlist
+	limiter   *ratelimit.Limiter
 }
 
 func New(cfg *config.Config) (*Server, error) {
@@ -46,11 +91,19 @@ func New(cfg *config.Config) (*Server, error) {
 		labels = append(labels, otelattr.String(k, v))
 	}
 
+	metricsLabels := otelapi.WithAttributeSet(otelattr.NewSet(labels...))
+
 	location := types.Location{}
 	copy(location[:], []byte(cfg.Metrics.Location))
 
+	allowlist := newAllowlist(&cfg.Responder)
+
 	peers := make(map[uuid.UUID]*types.Peer, len(cfg.Transponder.Peers))
 	for _, peer := range cfg.Transponder.Peers {
+		if addr, err := peer.UDPAddress(); err == nil { // the rest are added upon resolve
+			allowlist.addPeer(addr.IP)
+		}
+
 		peerUUID := srvUUID
 
 		if peer.Name() != "localhost" {
@@ -62,6 +115,11 @@ func New(cfg *config.Config) (*Server, error) {
 		peers[peerUUID] = &peer
 	}
 
+	var q *quantiles
+	if len(cfg.Metrics.QuantileWindows) > 0 && len(cfg.Metrics.Quantiles) > 0 {
+		q = newQuantiles(&cfg.Metrics)
+	}
+
 	return &Server{
 		cfg: cfg,
 		log: l,
@@ -69,8 +127,29 @@ func New(cfg *config.Config) (*Server, error) {
 		uuid:  srvUUID,
 		peers: peers,
 
-		labels:   otelapi.WithAttributeSet(otelattr.NewSet(labels...)),
-		location: location,
+		transponders: make([]runnable, 0, len(cfg.Transponder.ListenAddresses)),
+		listeners:    make([]*transponder.Transponder, 0, len(cfg.Transponder.ListenAddresses)),
+		sources:      make(map[string]*transponder.Transponder),
+		twampSenders: make(map[uuid.UUID]*transponder.Transponder),
+		pingers:      make(map[string]*transponder.Pinger),
+
+		httpClients: make(map[uuid.UUID]*http.Client),
+		quicDialers: make(map[uuid.UUID]*transponder.QUICDialer),
+		streams:     make(map[uuid.UUID]*transponder.StreamDialer),
+
+		paths: make(map[uuid.UUID]*traceroute.Path),
+		seen:  make(map[uuid.UUID]*peerState),
+
+		twampReflectors: make(map[uuid.UUID]string),
+
+		labels:    metricsLabels,
+		location:  location,
+		locations: newLocationLabels(&cfg.Metrics, metricsLabels),
+		quantiles: q,
+		smoothed:  newSmoothed(cfg.Metrics.LatencyEWMAAlpha),
+
+		allowlist: allowlist,
+		limiter:   ratelimit.New(&cfg.Responder),
 	}, nil
 }
 
@@ -82,30 +161,155 @@ func (s *Server) Run() error {
 		return err
 	}
 
+	if s.cfg.Transponder.Initiates() {
+		if _, err := metrics.RegisterCallback(s.reportPeers,
+			metrics.GaugePeerInfo, metrics.GaugePeerLastSeen, metrics.GaugePeerUp,
+		); err != nil {
+			return err
+		}
+	}
+
+	if s.quantiles != nil {
+		if _, err := metrics.RegisterCallback(s.quantiles.report(s.labels), metrics.GaugeLatencyQuantile); err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.Metrics.StatsDAddress != "" {
+		c, err := statsd.New(&s.cfg.Metrics)
+		if err != nil {
+			return err
+		}
+		s.statsd = c
+	}
+
+	metrics.GaugeMode.Record(ctx, 1, s.labels, otelapi.WithAttributes(
+		otelattr.String("mode", s.cfg.Transponder.Mode),
+	))
+
 	metricsServer, err := s.newMetricsServer(ctx)
 	if err != nil {
 		return err
 	}
 
-	transponder, err := transponder.New(&s.cfg.Transponder)
-	if err != nil {
-		return err
+	{ // setup the transponders
+		for _, listenAddress := range s.cfg.Transponder.ListenAddresses {
+			t, err := transponder.New(&s.cfg.Transponder, listenAddress)
+			if err != nil {
+				return err
+			}
+			t.Receive = s.receiveProbes(ctx)
+			s.transponders = append(s.transponders, t)
+			s.listeners = append(s.listeners, t)
+		}
+		if len(s.listeners) == 0 {
+			return ErrNoListenAddresses
+		}
+
+		for _, listenAddress := range s.cfg.Transponder.TWAMPListenAddresses {
+			t, err := transponder.New(&s.cfg.Transponder, listenAddress)
+			if err != nil {
+				return err
+			}
+			t.Receive = s.receiveTWAMP(ctx)
+			s.transponders = append(s.transponders, t)
+		}
+
+		for _, listenAddress := range s.cfg.Transponder.QUICListenAddresses {
+			l, err := transponder.NewQUICListener(listenAddress)
+			if err != nil {
+				return err
+			}
+			l.Accept = s.acceptConn(ctx, listenAddress)
+			l.Receive = s.receiveConn(ctx, protocolQUIC)
+			s.transponders = append(s.transponders, l)
+		}
+
+		for _, listenAddress := range s.cfg.Transponder.StreamListenAddresses {
+			l, err := transponder.NewStreamListener(listenAddress, s.cfg.Transponder.StreamIdleTimeout)
+			if err != nil {
+				return err
+			}
+			l.Accept = s.acceptConn(ctx, listenAddress)
+			l.Receive = s.receiveConn(ctx, protocolTCPStream)
+			s.transponders = append(s.transponders, l)
+		}
+
+		for peerUUID, peer := range s.peers {
+			if !s.cfg.Transponder.Initiates() {
+				break
+			}
+			source := peer.Source()
+			switch peer.Kind() {
+			case types.PeerKindHTTP:
+				s.httpClients[peerUUID] = s.newHTTPClient(peer)
+				continue
+			case types.PeerKindQUIC:
+				d := transponder.NewQUICDialer(peer, s.cfg.Transponder.ConnectTimeout)
+				d.Receive = s.receiveConn(ctx, protocolQUIC)
+				d.OnReconnect = s.countReconnects(ctx, peer, protocolQUIC)
+				s.transponders = append(s.transponders, d)
+				s.quicDialers[peerUUID] = d
+				continue
+			case types.PeerKindTCPStream:
+				d := transponder.NewStreamDialer(peer, s.cfg.Transponder.ConnectTimeout)
+				d.Receive = s.receiveConn(ctx, protocolTCPStream)
+				d.OnReconnect = s.countReconnects(ctx, peer, protocolTCPStream)
+				s.transponders = append(s.transponders, d)
+				s.streams[peerUUID] = d
+				continue
+			case types.PeerKindTCP: // dialed on demand
+				continue
+			case types.PeerKindICMP:
+				network := icmpNetwork(peer)
+				if _, exists := s.pingers[pingerKey(network, source)]; exists {
+					continue
+				}
+				p := transponder.NewPinger(network, source)
+				p.Receive = s.receiveEchoReplies(ctx)
+				s.transponders = append(s.transponders, p)
+				s.pingers[pingerKey(network, source)] = p
+				continue
+			case types.PeerKindTWAMP: // reflectors reply to the port we send from
+				t, err := transponder.NewSource(&s.cfg.Transponder, source)
+				if err != nil {
+					return err
+				}
+				t.Receive = s.receiveTWAMPReturns(ctx, peerUUID)
+				s.transponders = append(s.transponders, t)
+				s.twampSenders[peerUUID] = t
+				continue
+			}
+			if _, exists := s.sources[source.String()]; exists || source.IsZero() {
+				continue
+			}
+			t, err := transponder.NewSource(&s.cfg.Transponder, source)
+			if err != nil {
+				return err
+			}
+			t.Receive = s.receiveProbes(ctx)
+			s.transponders = append(s.transponders, t)
+			s.sources[source.String()] = t
+		}
 	}
-	transponder.Receive = s.receiveProbes(ctx)
 
 	ticker := time.NewTicker(s.cfg.Transponder.Interval)
 
 	failure := make(chan error, 1)
 
-	go func() { // run the transponder
-		l.Info("Latency monitor transponder is going up...",
-			zap.String("responder_listen_address", s.cfg.Transponder.ListenAddress),
-		)
-		if err := transponder.Run(ctx); err != nil {
-			failure <- err
-		}
-		l.Info("Latency monitor transponder is down")
-	}()
+	for _, t := range s.transponders { // run the transponders
+		go func() {
+			l.Info("Latency monitor transponder is going up...",
+				zap.String("responder_listen_address", t.Name()),
+			)
+			if err := t.Run(ctx); err != nil {
+				failure <- err
+			}
+			l.Info("Latency monitor transponder is down",
+				zap.String("responder_listen_address", t.Name()),
+			)
+		}()
+	}
 
 	go func() { // run the metrics-server
 		l.Info("Latency monitor metrics-server is going up...",
@@ -117,16 +321,20 @@ func (s *Server) Run() error {
 		l.Info("Latency monitor metrics-server is down")
 	}()
 
-	go func() { // run the ticker
-		for {
-			<-ticker.C
-			if !transponder.IsRunning() {
-				l.Warn("Transponder is not running...")
-				continue
+	if s.cfg.Transponder.Initiates() {
+		go func() { // run the ticker
+			for {
+				<-ticker.C
+				s.sendProbes(ctx)
 			}
-			s.sendProbes(ctx, transponder)
-		}
-	}()
+		}()
+	}
+
+	var pathTicker *time.Ticker
+	if s.cfg.PathDiscovery.Interval > 0 {
+		pathTicker = time.NewTicker(s.cfg.PathDiscovery.Interval)
+		go s.discoverPaths(ctx, pathTicker) // run the path discovery
+	}
 
 	{ // wait until termination or internal failure
 		terminator := make(chan os.Signal, 1)
@@ -144,19 +352,25 @@ func (s *Server) Run() error {
 		}
 	}
 
-	{ // stop the ticker
+	{ // stop the tickers
 		ticker.Stop()
+		if pathTicker != nil {
+			pathTicker.Stop()
+		}
 	}
 
-	{ // stop the transponder
+	{ // stop the transponders
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
-		if err := transponder.Shutdown(ctx); err != nil {
-			l.Error("Error while shutting down latency monitor transponder",
-				zap.Error(err),
-			)
+		for _, t := range s.transponders {
+			if err := t.Shutdown(ctx); err != nil {
+				l.Error("Error while shutting down latency monitor transponder",
+					zap.Error(err),
+					zap.String("responder_listen_address", t.Name()),
+				)
+			}
 		}
-		l.Info("Latency monitor transponder is down")
+		l.Info("Latency monitor transponders are down")
 	}
 
 	{ // stop the metrics-server
@@ -169,13 +383,50 @@ func (s *Server) Run() error {
 		}
 	}
 
+	{ // flush the pushed metrics
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if err := metrics.Shutdown(ctx); err != nil {
+			l.Error("Latency monitor metrics shutdown failed",
+				zap.Error(err),
+			)
+		}
+		if err := s.statsd.Close(); err != nil {
+			l.Error("Latency monitor statsd client shutdown failed",
+				zap.Error(err),
+			)
+		}
+	}
+
 	return nil
 }
 
+// sender returns the transponder to send the probes to the peer through.
+func (s *Server) sender(peer *types.Peer, addr *net.UDPAddr) (*transponder.Transponder, error) {
+	if source := peer.Source(); !source.IsZero() {
+		return s.sources[source.String()], nil
+	}
+	for _, t := range s.listeners {
+		if t.CanSendTo(addr) {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s",
+		ErrNoSuitableListener, addr.String(),
+	)
+}
+
 func (s *Server) newMetricsServer(ctx context.Context) (*http.Server, error) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleHealthcheck)
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("GET /paths", s.handleGetPaths)
+	mux.HandleFunc("POST /paths/{peer}", s.handleDiscoverPath)
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: s.cfg.Metrics.Exemplars, // the exemplars need it
+		}),
+	))
 	handler := httplogger.Middleware(s.log, mux)
 
 	srv := &http.Server{
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamReconnect(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	free, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenAddress := free.Addr().String()
+	free.Close()
+
+	runListener := func() *transponder.StreamListener {
+		l, err := transponder.NewStreamListener(listenAddress, time.Minute)
+		require.NoError(t, err)
+		l.Receive = s.receiveConn(ctx, protocolTCPStream)
+		go func() {
+			_ = l.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			_ = l.Shutdown(ctx)
+		})
+		return l
+	}
+	listener := runListener()
+
+	peer, err := types.NewPeer("remote=tcp-stream://" + listenAddress + ";dscp=46")
+	require.NoError(t, err)
+	peerUUID := uuid.New()
+	s.peers = map[uuid.UUID]*types.Peer{peerUUID: &peer}
+
+	dialer := transponder.NewStreamDialer(&peer, cfg.Transponder.ConnectTimeout)
+	dialer.Receive = s.receiveConn(ctx, protocolTCPStream)
+	dialer.OnReconnect = s.countReconnects(ctx, &peer, protocolTCPStream)
+	s.streams[peerUUID] = dialer
+	go func() {
+		_ = dialer.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		_ = dialer.Shutdown(ctx)
+	})
+
+	labels := map[string]string{"peer": "remote", "protocol": "tcp-stream"}
+	returnedBefore := counterValue(t, "latency_monitor_probe_returned_count_total", labels)
+	reconnectsBefore := counterValue(t, "latency_monitor_peer_reconnect_count_total", labels)
+
+	for i := 1; i <= 2; i++ {
+		require.Eventually(t, dialer.IsConnected, 5*time.Second, 10*time.Millisecond)
+
+		s.sendProbes(ctx)
+		require.Eventually(t, func() bool {
+			return counterValue(t, "latency_monitor_probe_returned_count_total", labels)-returnedBefore == float64(i)
+		}, time.Second, 10*time.Millisecond)
+
+		if i == 1 { // bring the stream down
+			require.NoError(t, listener.Shutdown(ctx))
+			require.Eventually(t, func() bool { return !dialer.IsConnected() }, time.Second, 10*time.Millisecond)
+			listener = runListener()
+		}
+	}
+
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_peer_reconnect_count_total", labels)-reconnectsBefore)
+}
+
+func TestStreamListenerClosesRejectedAndIdle(t *testing.T) {
+	_, allowed, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	_, elsewhere, err := net.ParseCIDR("192.0.2.0/24")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		network *net.IPNet
+		reason  string
+	}{
+		"rejected": {network: elsewhere, reason: rejectReasonNetwork},
+		"idle":     {network: allowed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Responder = config.Responder{AllowedNetworks: []*net.IPNet{tc.network}}
+			s, _ := newTestServer(t, cfg)
+
+			free, err := net.Listen("tcp4", "127.0.0.1:0")
+			require.NoError(t, err)
+			listenAddress := free.Addr().String()
+			free.Close()
+
+			l, err := transponder.NewStreamListener(listenAddress, 100*time.Millisecond)
+			require.NoError(t, err)
+			l.Accept = s.acceptConn(ctx, "stream")
+			l.Receive = s.receiveConn(ctx, protocolTCPStream)
+			go func() {
+				_ = l.Run(ctx)
+			}()
+			t.Cleanup(func() {
+				_ = l.Shutdown(ctx)
+			})
+
+			labels := map[string]string{"reason": tc.reason, "listener": "stream"}
+			rejectedBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", labels)
+
+			var conn net.Conn
+			require.Eventually(t, func() bool {
+				conn, err = net.Dial("tcp", listenAddress)
+				return err == nil
+			}, time.Second, 10*time.Millisecond)
+			defer conn.Close()
+
+			// the stream gets closed by the listener either way
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			require.Error(t, err)
+			require.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+
+			if tc.reason != "" {
+				require.Equal(t, 1.0, counterValue(t, "latency_monitor_probe_rejected_count_total", labels)-rejectedBefore)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	protocolTCP       = "tcp"
+	protocolTCPStream = "tcp-stream"
+
+	connectErrorOther       = "other"
+	connectErrorRefused     = "refused"
+	connectErrorTimeout     = "timeout"
+	connectErrorUnreachable = "unreachable"
+)
+
+// sendTCPConnect measures the time it takes to establish tcp connection to
+// the peer (i.e. the time between sending SYN and receiving SYN-ACK).  The
+// connection is made asynchronously, so that slow peers do not delay the
+// others' probes.
+func (s *Server) sendTCPConnect(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer, addr *net.UDPAddr) {
+	l := logutils.LoggerFromContext(ctx)
+
+	dscp := strconv.Itoa(int(peer.DSCP()))
+	peerSource := peer.Source().String()
+	dialer := transponder.NewDialer(peer.Source(), peer.DSCP(), s.cfg.Transponder.ConnectTimeout)
+
+	sentAttrs := []otelattr.KeyValue{
+		otelattr.String("peer", peer.Name()),
+		otelattr.String("dscp", dscp),
+		otelattr.String("source", peerSource),
+		otelattr.String("protocol", protocolTCP),
+	}
+	metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(sentAttrs...))
+	s.statsd.Count("probe_sent_count", 1, sentAttrs...)
+
+	go func() {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port)))
+		ts := time.Now()
+		if err != nil {
+			metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", classifyConnectError(err)),
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("protocol", protocolTCP),
+			))
+			l.Warn("Failed to connect to a peer",
+				zap.Error(err),
+				zap.String("peer", peer.Name()),
+			)
+			return
+		}
+		_ = conn.Close()
+
+		roundTripLatency := float64(ts.Sub(start).Microseconds())
+		roundTripAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocolTCP),
+		}
+		metrics.Latency(peer.BucketProfile()).RoundTrip.Record(ctx, roundTripLatency, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocolTCP, directionRoundTrip}, roundTripLatency, roundTripAttrs...)
+		s.statsd.Timing("round_trip_latency", roundTripLatency, roundTripAttrs...)
+
+		metrics.CountProbeReturned.Add(ctx, 1, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.markSeen(peerUUID, "")
+		s.statsd.Count("probe_returned_count", 1, roundTripAttrs...)
+		l.Debug("Connected to a peer",
+			zap.Float64("round_trip_latency_ms", roundTripLatency),
+			zap.String("name", peer.Name()),
+		)
+	}()
+}
+
+func classifyConnectError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return connectErrorRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return connectErrorUnreachable
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return connectErrorTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return connectErrorTimeout
+	default:
+		return connectErrorOther
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/statsd"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPConnect(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	closed, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+
+	for _, tc := range []struct {
+		address string
+		metric  string
+		labels  map[string]string
+	}{
+		{
+			address: listener.Addr().String(),
+			metric:  "latency_monitor_probe_returned_count_total",
+			labels:  map[string]string{"peer": "open", "protocol": "tcp"},
+		},
+		{
+			address: closed.Addr().String(),
+			metric:  "latency_monitor_failed_probe_send_count_total",
+			labels:  map[string]string{"peer": "closed", "protocol": "tcp", "error_type": "refused"},
+		},
+	} {
+		peer, err := types.NewPeer(tc.labels["peer"] + "=tcp://" + tc.address)
+		require.NoError(t, err)
+		addr, err := peer.UDPAddress()
+		require.NoError(t, err)
+
+		before := counterValue(t, tc.metric, tc.labels)
+		s.sendTCPConnect(ctx, uuid.New(), &peer, addr)
+		require.Eventually(t, func() bool {
+			return counterValue(t, tc.metric, tc.labels)-before == 1
+		}, time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestTCPConnectStatsD(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Transponder.ConnectTimeout = time.Second
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	agent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		agent.Close()
+	})
+	s.statsd, err = statsd.New(&config.Metrics{StatsDAddress: agent.LocalAddr().String()})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	peer, err := types.NewPeer("open=tcp://" + listener.Addr().String())
+	require.NoError(t, err)
+	addr, err := peer.UDPAddress()
+	require.NoError(t, err)
+	s.sendTCPConnect(ctx, uuid.New(), &peer, addr)
+
+	// the sent and returned counts must match for the statsd too
+	names := []string{}
+	buf := make([]byte, 1500)
+	for range 3 {
+		require.NoError(t, agent.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := agent.Read(buf)
+		require.NoError(t, err)
+		name, _, _ := strings.Cut(string(buf[:n]), ":")
+		names = append(names, name)
+	}
+	require.Equal(t, []string{"probe_sent_count", "round_trip_latency", "probe_returned_count"}, names)
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/metrics"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	otelattr "go.opentelemetry.io/otel/attribute"
+	otelapi "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnexpectedTWAMPReflector = errors.New("twamp test packet from unexpected reflector")
+)
+
+const (
+	protocolTWAMP = "twamp"
+	protocolUDP   = "udp"
+)
+
+// sendTWAMPProbe sends a twamp-light test packet to the peer's
+// session-reflector.  The returns are handled by receiveTWAMPReturns.
+func (s *Server) sendTWAMPProbe(ctx context.Context, peerUUID uuid.UUID, peer *types.Peer, addr *net.UDPAddr) {
+	l := logutils.LoggerFromContext(ctx)
+
+	t := s.twampSenders[peerUUID]
+	if !t.IsRunning() {
+		l.Warn("Transponder is not running...",
+			zap.String("responder_listen_address", t.Name()),
+		)
+		return
+	}
+
+	s.twampMx.Lock()
+	s.twampReflectors[peerUUID] = twampKey(addr)
+	s.twampMx.Unlock()
+
+	p := types.TWAMPSenderPacket{
+		Sequence:      uint32(peer.Sequence()),
+		ErrorEstimate: types.TWAMPErrorEstimateUnknown,
+		PaddingSize:   types.TWAMPReflectorPacketSize() - types.TWAMPSenderPacketSize(), // symmetric size (rfc 6038)
+	}
+	p.Timestamp = time.Now()
+
+	b, err := p.MarshalBinary()
+	if err != nil {
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to prepare a twamp test packet",
+			zap.Error(err),
+		)
+		return
+	}
+
+	t.Send(b, addr, peer.DSCP(), func(err error) {
+		metrics.CounterFailedProbeSend.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+			otelattr.String("error_type", reflect.TypeOf(err).String()),
+		))
+		l.Error("Failed to send a twamp test packet",
+			zap.Error(err),
+		)
+	})
+
+	sentAttrs := []otelattr.KeyValue{
+		otelattr.String("peer", peer.Name()),
+		otelattr.String("dscp", strconv.Itoa(int(peer.DSCP()))),
+		otelattr.String("source", peer.Source().String()),
+		otelattr.String("protocol", protocolTWAMP),
+	}
+	metrics.CountProbeSent.Add(ctx, 1, s.labels, otelapi.WithAttributes(sentAttrs...))
+	s.statsd.Count("probe_sent_count", 1, sentAttrs...)
+	l.Debug("Sent a twamp test packet",
+		zap.String("name", peer.Name()),
+	)
+}
+
+// receiveTWAMP acts as a stateless twamp-light session-reflector.
+func (s *Server) receiveTWAMP(ctx context.Context) transponder.Receive {
+	l := logutils.LoggerFromContext(ctx)
+
+	return func(t *transponder.Transponder, input []byte, source *net.UDPAddr, meta transponder.Metadata) {
+		ts := time.Now()
+
+		reason := ""
+		if allowed, r := s.allowlist.allow(source.IP); !allowed {
+			reason = r
+		} else if !s.cfg.Transponder.Responds() {
+			reason = rejectReasonMode
+		} else if len(input) < types.TWAMPReflectorPacketSize() { // no amplification
+			reason = rejectReasonSize
+		}
+		if reason != "" {
+			metrics.CounterProbeRejected.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("reason", reason),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Debug("Rejected a twamp test packet",
+				zap.String("reason", reason),
+				zap.String("source", source.String()),
+			)
+			return
+		}
+
+		p := types.TWAMPSenderPacket{}
+		if err := p.UnmarshalBinary(input); err != nil {
+			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Error("Invalid twamp test packet",
+				zap.Error(err),
+				zap.String("source", source.String()),
+			)
+			return
+		}
+
+		if allowed, reason := s.limiter.Allow(source.IP, ts); !allowed {
+			metrics.CounterProbeReplyThrottled.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("reason", reason),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Debug("Throttled reply to a twamp test packet",
+				zap.String("reason", reason),
+				zap.String("source", source.String()),
+			)
+			return
+		}
+
+		dscp := meta.DSCP
+		if dscp == types.DSCPUnknown {
+			dscp = 0
+		}
+
+		r := types.TWAMPReflectorPacket{
+			Sequence:            p.Sequence, // stateless reflector (rfc 5357, section 4.2.1)
+			ErrorEstimate:       types.TWAMPErrorEstimateUnknown,
+			ReceiveTimestamp:    ts,
+			SenderSequence:      p.Sequence,
+			SenderTimestamp:     p.Timestamp,
+			SenderErrorEstimate: p.ErrorEstimate,
+			SenderTTL:           meta.TTL,
+			PaddingSize:         len(input) - types.TWAMPReflectorPacketSize(), // symmetric size (rfc 6038)
+		}
+		r.Timestamp = time.Now()
+
+		output, err := r.MarshalBinary()
+		if err != nil {
+			metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Error("Failed to prepare response to a twamp test packet",
+				zap.Error(err),
+			)
+			return
+		}
+
+		t.Reply(meta, output, source, dscp, func(err error) { // reply within the same class
+			metrics.CounterFailedProbeRespond.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Error("Failed to respond to a twamp test packet",
+				zap.Error(err),
+			)
+		})
+
+		respondedAttrs := []otelattr.KeyValue{
+			otelattr.String("listener", t.Name()),
+			otelattr.String("protocol", protocolTWAMP),
+		}
+		metrics.CountProbeResponded.Add(ctx, 1, s.labels, otelapi.WithAttributes(respondedAttrs...))
+		s.statsd.Count("probe_responded_count", 1, respondedAttrs...)
+	}
+}
+
+// receiveTWAMPReturns handles the test packets sent back to us by the peer's
+// session-reflector.  Every twamp peer has the sender of its own, so that the
+// peers that share the same reflector (e.g. with different dscp) are told
+// apart.
+func (s *Server) receiveTWAMPReturns(ctx context.Context, peerUUID uuid.UUID) transponder.Receive {
+	l := logutils.LoggerFromContext(ctx)
+
+	return func(t *transponder.Transponder, input []byte, source *net.UDPAddr, meta transponder.Metadata) {
+		ts := time.Now()
+
+		p := types.TWAMPReflectorPacket{}
+		if err := p.UnmarshalBinary(input); err != nil {
+			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Error("Invalid twamp test packet",
+				zap.Error(err),
+				zap.String("source", source.String()),
+			)
+			return
+		}
+
+		s.twampMx.RLock()
+		reflector, known := s.twampReflectors[peerUUID]
+		s.twampMx.RUnlock()
+		if !known || reflector != twampKey(source) {
+			err := fmt.Errorf("%w: %s",
+				ErrUnexpectedTWAMPReflector, source.String(),
+			)
+			metrics.CounterInvalidProbeReceived.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("error_type", reflect.TypeOf(err).String()),
+				otelattr.String("listener", t.Name()),
+			))
+			l.Error("Invalid return twamp test packet",
+				zap.Error(err),
+			)
+			return
+		}
+		peer := s.peers[peerUUID]
+
+		dscp := strconv.Itoa(int(peer.DSCP()))
+		peerSource := peer.Source().String()
+		latency := metrics.Latency(peer.BucketProfile())
+		exemplarCtx := metrics.ContextWithExemplar(ctx)
+		exemplarAttrs := otelapi.WithAttributes(metrics.ExemplarAttributes(uint64(p.SenderSequence), p.SenderTimestamp, p.ReceiveTimestamp)...)
+
+		// the reflectors have no location of their own, hence the peer name
+		forwardLatency := float64(p.ReceiveTimestamp.Sub(p.SenderTimestamp).Microseconds())
+		forwardAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("from", s.location.String()),
+			otelattr.String("to", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocolTWAMP),
+		}
+		latency.ForwardTrip.Record(exemplarCtx, forwardLatency, s.labels, otelapi.WithAttributes(forwardAttrs...), exemplarAttrs)
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocolTWAMP, directionForward}, forwardLatency, forwardAttrs...)
+		s.statsd.Timing("forward_trip_latency", forwardLatency, forwardAttrs...)
+
+		returnLatency := float64(ts.Sub(p.Timestamp).Microseconds())
+		returnAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("to", s.location.String()),
+			otelattr.String("from", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocolTWAMP),
+		}
+		latency.ReturnTrip.Record(exemplarCtx, returnLatency, s.labels, otelapi.WithAttributes(returnAttrs...), exemplarAttrs)
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocolTWAMP, directionReturn}, returnLatency, returnAttrs...)
+		s.statsd.Timing("return_trip_latency", returnLatency, returnAttrs...)
+
+		roundTripLatency := float64(ts.Sub(p.SenderTimestamp).Microseconds())
+		roundTripAttrs := []otelattr.KeyValue{
+			otelattr.String("peer", peer.Name()),
+			otelattr.String("dscp", dscp),
+			otelattr.String("source", peerSource),
+			otelattr.String("protocol", protocolTWAMP),
+		}
+		latency.RoundTrip.Record(ctx, roundTripLatency, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.observeLatency(ctx, latencyKey{peer.Name(), dscp, peerSource, protocolTWAMP, directionRoundTrip}, roundTripLatency, roundTripAttrs...)
+		s.statsd.Timing("round_trip_latency", roundTripLatency, roundTripAttrs...)
+
+		if meta.DSCP != types.DSCPUnknown && meta.DSCP != peer.DSCP() {
+			metrics.CounterDSCPRemarked.Add(ctx, 1, s.labels, otelapi.WithAttributes(
+				otelattr.String("peer", peer.Name()),
+				otelattr.String("dscp", dscp),
+				otelattr.String("source", peerSource),
+				otelattr.String("direction", "return"),
+				otelattr.String("remarked_dscp", strconv.Itoa(int(meta.DSCP))),
+			))
+		}
+
+		metrics.CountProbeReturned.Add(ctx, 1, s.labels, otelapi.WithAttributes(roundTripAttrs...))
+		s.markSeen(peerUUID, "")
+		s.statsd.Count("probe_returned_count", 1, roundTripAttrs...)
+		l.Debug("Received a return twamp test packet",
+			zap.Float64("forward_latency_ms", forwardLatency),
+			zap.Float64("return_latency_ms", returnLatency),
+			zap.Float64("round_trip_latency_ms", roundTripLatency),
+			zap.String("name", peer.Name()),
+		)
+	}
+}
+
+// twampKey normalises the address of the reflector (dual-stack sockets report
+// the ip4 ones as ip4-mapped ip6).
+func twampKey(addr *net.UDPAddr) string {
+	ap := addr.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()).String()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTWAMPLoopback(t *testing.T) {
+	cfg := newTestConfig()
+	s, _ := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	run := func(tr *transponder.Transponder) {
+		go func() {
+			_ = tr.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			_ = tr.Shutdown(ctx)
+		})
+		require.Eventually(t, tr.IsRunning, time.Second, time.Millisecond)
+	}
+
+	reflector, err := transponder.New(&cfg.Transponder, "127.0.0.1:0")
+	require.NoError(t, err)
+	reflector.Receive = s.receiveTWAMP(ctx)
+	run(reflector)
+
+	// the same reflector within different classes
+	s.peers = map[uuid.UUID]*types.Peer{}
+	for _, dscp := range []string{"0", "46"} {
+		peer, err := types.NewPeer("reflector=twamp://" + reflector.LocalAddr().String() + ";source=127.0.0.1;dscp=" + dscp)
+		require.NoError(t, err)
+		require.Equal(t, types.PeerKindTWAMP, peer.Kind())
+
+		peerUUID := uuid.New()
+		sender, err := transponder.NewSource(&cfg.Transponder, peer.Source())
+		require.NoError(t, err)
+		sender.Receive = s.receiveTWAMPReturns(ctx, peerUUID)
+		run(sender)
+
+		s.peers[peerUUID] = &peer
+		s.twampSenders[peerUUID] = sender
+	}
+
+	returnedBefore := map[string]float64{}
+	for _, dscp := range []string{"0", "46"} {
+		returnedBefore[dscp] = counterValue(t, "latency_monitor_probe_returned_count_total",
+			map[string]string{"peer": "reflector", "protocol": "twamp", "dscp": dscp},
+		)
+	}
+
+	s.sendProbes(ctx)
+
+	for _, dscp := range []string{"0", "46"} {
+		require.Eventually(t, func() bool {
+			return counterValue(t, "latency_monitor_probe_returned_count_total",
+				map[string]string{"peer": "reflector", "protocol": "twamp", "dscp": dscp},
+			)-returnedBefore[dscp] == 1
+		}, time.Second, 10*time.Millisecond, "dscp=%s", dscp)
+	}
+}
+
+func TestTWAMPRejectsShortPackets(t *testing.T) {
+	cfg := newTestConfig()
+	s, tr := newTestServer(t, cfg)
+	sink, countReplies := newSink(t)
+
+	p := types.TWAMPSenderPacket{
+		Sequence:      1,
+		Timestamp:     time.Now(),
+		ErrorEstimate: types.TWAMPErrorEstimateUnknown,
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	require.Less(t, len(b), types.TWAMPReflectorPacketSize())
+
+	labels := map[string]string{"reason": rejectReasonSize, "listener": tr.Name()}
+	rejectedBefore := counterValue(t, "latency_monitor_probe_rejected_count_total", labels)
+
+	s.receiveTWAMP(context.Background())(tr, b, sink, transponder.Metadata{})
+
+	require.Equal(t, 0, countReplies())
+	require.Equal(t, 1.0, counterValue(t, "latency_monitor_probe_rejected_count_total", labels)-rejectedBefore)
+}
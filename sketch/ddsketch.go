@@ -0,0 +1,126 @@
+package sketch
+
+import (
+	"math"
+	"slices"
+)
+
+// DDSketch is the quantile sketch with relative-error guarantee (see
+// https://arxiv.org/abs/1908.10693).  The latencies across the hosts can come
+// out negative (clock skews), hence there is a store for the negative values
+// too.
+type DDSketch struct {
+	accuracy float64
+	logGamma float64
+
+	positive map[int]uint64
+	negative map[int]uint64
+	zero     uint64
+	count    uint64
+}
+
+const (
+	minIndexable = 1e-9 // smaller (absolute) values go into zero bucket
+)
+
+// NewDDSketch returns the sketch that estimates the quantiles within the
+// relative accuracy (e.g. 0.01 for 1%).
+func NewDDSketch(accuracy float64) *DDSketch {
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &DDSketch{
+		accuracy: accuracy,
+		logGamma: math.Log(gamma),
+
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+	}
+}
+
+func (s *DDSketch) Add(value float64) {
+	switch {
+	case value > minIndexable:
+		s.positive[s.index(value)]++
+	case value < -minIndexable:
+		s.negative[s.index(-value)]++
+	default:
+		s.zero++
+	}
+	s.count++
+}
+
+// Merge adds all of the values of the other sketch (that must be of the same
+// accuracy) into this one.
+func (s *DDSketch) Merge(other *DDSketch) {
+	for i, c := range other.positive {
+		s.positive[i] += c
+	}
+	for i, c := range other.negative {
+		s.negative[i] += c
+	}
+	s.zero += other.zero
+	s.count += other.count
+}
+
+func (s *DDSketch) Count() uint64 {
+	return s.count
+}
+
+// Quantile returns the estimate of q-quantile (0 <= q <= 1), or false if the
+// sketch is empty.
+func (s *DDSketch) Quantile(q float64) (float64, bool) {
+	if s.count == 0 || q < 0 || q > 1 {
+		return 0, false
+	}
+
+	rank := uint64(q * float64(s.count-1))
+	seen := uint64(0)
+
+	negative := sortedIndices(s.negative)
+	for i := len(negative) - 1; i >= 0; i-- { // the most negative first
+		seen += s.negative[negative[i]]
+		if seen > rank {
+			return -s.value(negative[i]), true
+		}
+	}
+
+	seen += s.zero
+	if seen > rank {
+		return 0, true
+	}
+
+	positive := sortedIndices(s.positive)
+	for _, i := range positive {
+		seen += s.positive[i]
+		if seen > rank {
+			return s.value(i), true
+		}
+	}
+
+	return s.value(positive[len(positive)-1]), true
+}
+
+func (s *DDSketch) Reset() {
+	clear(s.positive)
+	clear(s.negative)
+	s.zero = 0
+	s.count = 0
+}
+
+func (s *DDSketch) index(value float64) int {
+	return int(math.Ceil(math.Log(value) / s.logGamma))
+}
+
+// value is the estimate of the values that fall into the bucket with the
+// index (the one with the least relative error towards both of its bounds).
+func (s *DDSketch) value(index int) float64 {
+	return math.Exp(float64(index)*s.logGamma) * (1 - s.accuracy)
+}
+
+func sortedIndices(store map[int]uint64) []int {
+	res := make([]int, 0, len(store))
+	for i := range store {
+		res = append(res, i)
+	}
+	slices.Sort(res)
+	return res
+}
@@ -0,0 +1,59 @@
+package sketch_test
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/sketch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDDSketchAccuracy(t *testing.T) {
+	const accuracy = 0.01
+
+	s := sketch.NewDDSketch(accuracy)
+	values := make([]float64, 0, 10000)
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 10000; i++ {
+		v := math.Exp(rnd.NormFloat64()*2 + 6) // long-tailed, ~400us median
+		if i%100 == 0 {
+			v = -v / 100 // clock skew
+		}
+		values = append(values, v)
+		s.Add(v)
+	}
+	slices.Sort(values)
+
+	for _, q := range []float64{0, 0.01, 0.5, 0.9, 0.99, 0.999, 1} {
+		expected := values[int(q*float64(len(values)-1))]
+		actual, ok := s.Quantile(q)
+		require.True(t, ok)
+		require.InEpsilon(t, expected, actual, accuracy*1.001, "q=%v", q)
+	}
+
+	_, ok := sketch.NewDDSketch(accuracy).Quantile(0.5)
+	require.False(t, ok)
+}
+
+func TestWindowSlides(t *testing.T) {
+	w := sketch.NewWindow(time.Minute, 0.01)
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 60; i++ {
+		w.Add(100, start.Add(time.Duration(i)*time.Second))
+	}
+	for i := 60; i < 120; i++ {
+		w.Add(1000, start.Add(time.Duration(i)*time.Second))
+	}
+
+	p50, ok := w.Quantile(0.5, start.Add(119*time.Second))
+	require.True(t, ok)
+	require.InEpsilon(t, 1000, p50, 0.01)
+	require.Equal(t, uint64(60), w.Sketch(start.Add(119*time.Second)).Count())
+
+	_, ok = w.Quantile(0.5, start.Add(10*time.Minute))
+	require.False(t, ok)
+}
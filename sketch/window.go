@@ -0,0 +1,64 @@
+package sketch
+
+import (
+	"time"
+)
+
+// Window is the sketch of the values added within the sliding time window.
+// The window slides in steps of 1/windowSlots of its length, so that the
+// estimates cover the last (windowSlots-1)/windowSlots to 1 of it.
+type Window struct {
+	accuracy float64
+	slot     time.Duration
+
+	slots  []*DDSketch
+	epochs []int64 // of the slots
+}
+
+const (
+	windowSlots = 6
+)
+
+func NewWindow(length time.Duration, accuracy float64) *Window {
+	w := &Window{
+		accuracy: accuracy,
+		slot:     max(length/windowSlots, 1),
+
+		slots:  make([]*DDSketch, windowSlots),
+		epochs: make([]int64, windowSlots),
+	}
+	for i := range w.slots {
+		w.slots[i] = NewDDSketch(accuracy)
+		w.epochs[i] = -1
+	}
+	return w
+}
+
+// Add adds the value observed at the moment.
+func (w *Window) Add(value float64, now time.Time) {
+	epoch := now.UnixNano() / int64(w.slot)
+	i := epoch % windowSlots
+	if w.epochs[i] != epoch { // the slot has slid out of the window
+		w.slots[i].Reset()
+		w.epochs[i] = epoch
+	}
+	w.slots[i].Add(value)
+}
+
+// Quantile returns the estimate of q-quantile of the values within the window
+// as of the moment, or false if there were none.
+func (w *Window) Quantile(q float64, now time.Time) (float64, bool) {
+	return w.Sketch(now).Quantile(q)
+}
+
+// Sketch returns the sketch of the values within the window as of the moment.
+func (w *Window) Sketch(now time.Time) *DDSketch {
+	epoch := now.UnixNano() / int64(w.slot)
+	res := NewDDSketch(w.accuracy)
+	for i, s := range w.slots {
+		if w.epochs[i] > epoch-windowSlots && w.epochs[i] <= epoch {
+			res.Merge(s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+package statsd
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/flashbots/latency-monitor/config"
+	otelattr "go.opentelemetry.io/otel/attribute"
+)
+
+// Client emits the metrics to statsd agent in dogstatsd format (that is, with
+// `|#tag:value` tags).  The nil client emits nothing.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	tags   string // constant ones, pre-formatted
+}
+
+var (
+	tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+)
+
+func New(cfg *config.Metrics) (*Client, error) {
+	conn, err := net.Dial("udp", cfg.StatsDAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(cfg.Labels))
+	for k, v := range cfg.Labels {
+		tags = append(tags, formatTag(otelattr.String(k, v)))
+	}
+	slices.Sort(tags)
+
+	return &Client{
+		conn:   conn,
+		prefix: cfg.StatsDPrefix,
+		tags:   strings.Join(tags, ","),
+	}, nil
+}
+
+// Count emits the counter increment.
+func (c *Client) Count(name string, value int64, tags ...otelattr.KeyValue) {
+	if c == nil {
+		return
+	}
+	c.emit(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Timing emits the raw timing sample (given in microseconds, as are all of
+// our latencies) for the agent to aggregate.
+func (c *Client) Timing(name string, us float64, tags ...otelattr.KeyValue) {
+	if c == nil {
+		return
+	}
+	c.emit(name, strconv.FormatFloat(us/1000, 'f', -1, 64), "ms", tags)
+}
+
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *Client) emit(name, value, kind string, tags []otelattr.KeyValue) {
+	b := strings.Builder{}
+	b.WriteString(c.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	if c.tags != "" || len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(c.tags)
+		for i, tag := range tags {
+			if i > 0 || c.tags != "" {
+				b.WriteByte(',')
+			}
+			b.WriteString(formatTag(tag))
+		}
+	}
+
+	_, _ = c.conn.Write([]byte(b.String())) // best effort, as is statsd itself
+}
+
+func formatTag(tag otelattr.KeyValue) string {
+	return tagReplacer.Replace(string(tag.Key)) + ":" + tagReplacer.Replace(tag.Value.Emit())
+}
@@ -0,0 +1,44 @@
+package statsd_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/statsd"
+	"github.com/stretchr/testify/require"
+	otelattr "go.opentelemetry.io/otel/attribute"
+)
+
+func TestClient(t *testing.T) {
+	agent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer agent.Close()
+
+	c, err := statsd.New(&config.Metrics{
+		Labels:        map[string]string{"env": "test", "dc": "x"},
+		StatsDAddress: agent.LocalAddr().String(),
+		StatsDPrefix:  "latency_monitor.",
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	read := func() string {
+		buf := make([]byte, 1500)
+		_ = agent.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := agent.ReadFromUDP(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	c.Count("probe_sent_count", 1, otelattr.String("peer", "a"))
+	require.Equal(t, "latency_monitor.probe_sent_count:1|c|#dc:x,env:test,peer:a", read())
+
+	c.Timing("round_trip_latency", 1234, otelattr.String("peer", "a|b"), otelattr.String("to", "x,y"))
+	require.Equal(t, "latency_monitor.round_trip_latency:1.234|ms|#dc:x,env:test,peer:a_b,to:x_y", read())
+
+	var nop *statsd.Client
+	nop.Count("probe_sent_count", 1) // no-op
+	require.NoError(t, nop.Close())
+}
@@ -0,0 +1,299 @@
+package traceroute
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// Hop is the router (or the destination itself) that has replied to the
+// probe with the corresponding ttl.
+type Hop struct {
+	TTL   int    `json:"ttl"`
+	IP    net.IP `json:"ip"`     // nil if nothing replied within the timeout
+	RTTUs int64  `json:"rtt_us"` // zero if nothing replied within the timeout
+}
+
+// Path is the list of hops towards the destination.
+type Path struct {
+	Destination net.IP    `json:"destination"`
+	Hops        []Hop     `json:"hops"`
+	Reached     bool      `json:"reached"` // whether the destination has replied
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Options tune the path discovery.
+type Options struct {
+	Source     net.IP        // local address to send the probes from (optional)
+	Device     string        // network device to send the probes through (optional)
+	SourcePort int           // of the probes (defaults to the traditional 33434)
+	MaxHops    int           // max ttl to probe with
+	Timeout    time.Duration // to wait for the replies
+}
+
+const (
+	defaultPort = 33434 // traditional traceroute port
+	icmpSize    = 1500
+	udpSize     = 8 + 2 // header + the payload that tunes the checksum
+)
+
+var (
+	ErrOnlyIP4 = errors.New("only ip4 destinations are supported by path discovery")
+)
+
+// Trace discovers the path towards the destination by sending it udp probes
+// with increasing ttl, and listening for icmp time-exceeded (or destination
+// unreachable) replies.  All of the probes are sent at once, so that the
+// discovery takes no longer than the timeout.
+//
+// All of the probes share the same flow (addresses and ports), so that the
+// routers that balance the traffic over multiple paths (ecmp) send them along
+// the same path (rather than reporting the hops of several paths mixed up).
+// The probes are told apart (the way paris-traceroute does it) by their udp
+// checksum, which is tuned to be equal to the ttl, and is quoted back in the
+// icmp replies.  The destination port is the traditional (closed) one, so that
+// the destination replies with port-unreachable (any icmp reply from the
+// destination tells it is reached).  Both sending such probes and receiving
+// icmp replies require raw sockets (and thus `CAP_NET_RAW` capability).
+func Trace(ctx context.Context, destination net.IP, opts Options) (*Path, error) {
+	dst := destination.To4()
+	if dst == nil {
+		return nil, fmt.Errorf("%w: %s",
+			ErrOnlyIP4, destination,
+		)
+	}
+
+	srcPort, dstPort := opts.SourcePort, defaultPort
+	if srcPort == 0 {
+		srcPort = defaultPort
+	}
+
+	source, err := sourceIP(dst, opts.Source, opts.Device)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := icmp.ListenPacket("ip4:icmp", source.String())
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close() // not bound to the device (the replies may come back through another one)
+
+	conn, err := net.ListenIP("ip4:udp", &net.IPAddr{IP: source})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	if err := transponder.BindToDevice(raw, opts.Device); err != nil {
+		return nil, err
+	}
+
+	pc := ipv4.NewPacketConn(conn)
+	sent := make([]time.Time, opts.MaxHops+1)
+	for ttl := 1; ttl <= opts.MaxHops; ttl++ {
+		if err := pc.SetTTL(ttl); err != nil {
+			return nil, err
+		}
+		sent[ttl] = time.Now()
+		probe := newProbe(source, dst, srcPort, dstPort, uint16(ttl))
+		if _, err := conn.WriteToIP(probe, &net.IPAddr{IP: dst}); err != nil {
+			return nil, err
+		}
+	}
+
+	path := &Path{
+		Destination: dst,
+		Hops:        make([]Hop, opts.MaxHops),
+		Timestamp:   sent[1],
+	}
+	for idx := range path.Hops {
+		path.Hops[idx].TTL = idx + 1
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := listener.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	reachedAt := opts.MaxHops + 1
+	buf := make([]byte, icmpSize)
+	for !path.complete(reachedAt) {
+		n, from, err := listener.ReadFrom(buf)
+		ts := time.Now()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		ttl, ok := match(buf[:n], dst, srcPort, dstPort)
+		if !ok || ttl < 1 || ttl > opts.MaxHops || path.Hops[ttl-1].IP != nil {
+			continue
+		}
+		ip := from.(*net.IPAddr).IP
+		path.Hops[ttl-1].IP = ip
+		path.Hops[ttl-1].RTTUs = ts.Sub(sent[ttl]).Microseconds()
+
+		if ip.Equal(dst) && ttl < reachedAt {
+			reachedAt = ttl
+		}
+	}
+
+	if reachedAt <= opts.MaxHops {
+		path.Hops = path.Hops[:reachedAt]
+		path.Reached = true
+	}
+
+	return path, nil
+}
+
+// complete tells whether all of the hops up to the destination have replied.
+func (p *Path) complete(reachedAt int) bool {
+	for idx := 0; idx < reachedAt-1 && idx < len(p.Hops); idx++ {
+		if p.Hops[idx].IP == nil {
+			return false
+		}
+	}
+	return reachedAt <= len(p.Hops)
+}
+
+// sourceIP returns the address the probes are sent from (the checksum of
+// the probes depends on it).
+func sourceIP(dst, source net.IP, device string) (net.IP, error) {
+	if source != nil && !source.IsUnspecified() {
+		return source.To4(), nil
+	}
+
+	// no packets are sent by "connecting" udp socket, the route is just
+	// looked up
+	dialer := transponder.NewDialer(types.Source{Device: device}, 0, 0)
+	conn, err := dialer.Dial("udp4", net.JoinHostPort(dst.String(), strconv.Itoa(defaultPort)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
+
+// newProbe returns the udp datagram (header included) with its checksum set
+// to the id by means of the payload.
+func newProbe(src, dst net.IP, srcPort, dstPort int, id uint16) []byte {
+	b := make([]byte, udpSize)
+	binary.BigEndian.PutUint16(b[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(b[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(b[4:6], udpSize)
+
+	// the checksum is the complement of the (one's complement) sum over the
+	// pseudo-header and the datagram, so the payload has to complete the sum
+	// of the rest up to the complement of the id
+	sum := onesSum(0, src.To4())
+	sum = onesSum(sum, dst.To4())
+	sum = onesSum(sum, []byte{0, syscall.IPPROTO_UDP, 0, udpSize})
+	sum = onesSum(sum, b)
+	binary.BigEndian.PutUint16(b[8:10], onesAdd(^id, ^sum))
+	binary.BigEndian.PutUint16(b[6:8], id)
+
+	return b
+}
+
+func onesSum(sum uint16, b []byte) uint16 {
+	for idx := 0; idx+1 < len(b); idx += 2 {
+		sum = onesAdd(sum, binary.BigEndian.Uint16(b[idx:]))
+	}
+	return sum
+}
+
+func onesAdd(a, b uint16) uint16 {
+	sum := uint32(a) + uint32(b)
+	return uint16(sum&0xffff + sum>>16)
+}
+
+// match tells the ttl of our probe the icmp message is the reply to.
+func match(b []byte, dst net.IP, srcPort, dstPort int) (int, bool) {
+	m, err := icmp.ParseMessage(ipv4.ICMPTypeTimeExceeded.Protocol(), b)
+	if err != nil {
+		return 0, false
+	}
+
+	var data []byte
+	switch body := m.Body.(type) {
+	case *icmp.TimeExceeded:
+		data = body.Data
+	case *icmp.DstUnreach:
+		data = body.Data
+	default:
+		return 0, false
+	}
+
+	// the original ip header along with (at least) 8 bytes of udp header
+	header, err := ipv4.ParseHeader(data)
+	if err != nil || !header.Dst.Equal(dst) || len(data) < header.Len+8 {
+		return 0, false
+	}
+	udp := data[header.Len:]
+	if int(binary.BigEndian.Uint16(udp[0:2])) != srcPort || int(binary.BigEndian.Uint16(udp[2:4])) != dstPort {
+		return 0, false
+	}
+
+	return int(binary.BigEndian.Uint16(udp[6:8])), true
+}
+
+// Equal tells whether the paths go through the same hops (the hops that did
+// not reply in either of the paths are considered matching).
+func (p *Path) Equal(other *Path) bool {
+	if len(p.Hops) != len(other.Hops) || p.Reached != other.Reached {
+		return false
+	}
+	for idx, hop := range p.Hops {
+		if hop.IP != nil && other.Hops[idx].IP != nil && !hop.IP.Equal(other.Hops[idx].IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// HopCount is the count of hops up to the last one that has replied.
+func (p *Path) HopCount() int {
+	for idx := len(p.Hops) - 1; idx >= 0; idx-- {
+		if p.Hops[idx].IP != nil {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// String returns the hops of the path (`*` for the ones that did not reply).
+func (p *Path) String() string {
+	res := ""
+	for idx, hop := range p.Hops {
+		if idx > 0 {
+			res += " "
+		}
+		if hop.IP == nil {
+			res += "*"
+		} else {
+			res += hop.IP.String()
+		}
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package traceroute_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/traceroute"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceLoopback(t *testing.T) {
+	path, err := traceroute.Trace(context.Background(), net.IPv4(127, 0, 0, 1), traceroute.Options{
+		MaxHops: 5,
+		Timeout: time.Second,
+	})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("raw icmp sockets are not permitted")
+	}
+	require.NoError(t, err)
+
+	require.True(t, path.Reached)
+	require.Len(t, path.Hops, 1)
+	require.True(t, path.Hops[0].IP.Equal(net.IPv4(127, 0, 0, 1)))
+	require.Equal(t, "127.0.0.1", path.String())
+}
+
+func TestTraceFixedFlow(t *testing.T) {
+	// raw socket gets the copies of all of the udp datagrams
+	sniffer, err := net.ListenIP("ip4:udp", &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("raw sockets are not permitted")
+	}
+	require.NoError(t, err)
+	defer sniffer.Close()
+
+	path, err := traceroute.Trace(context.Background(), net.IPv4(127, 0, 0, 1), traceroute.Options{
+		SourcePort: 32123,
+		MaxHops:    3,
+		Timeout:    time.Second,
+	})
+	require.NoError(t, err)
+	require.True(t, path.Reached)
+	require.Len(t, path.Hops, 1)
+
+	checksums := map[uint16]struct{}{}
+	buf := make([]byte, 1500)
+	for len(checksums) < 3 { // one per ttl, all of the same flow
+		require.NoError(t, sniffer.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := sniffer.ReadFromIP(buf) // without the ip header
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, n, 8)
+		if binary.BigEndian.Uint16(buf[0:2]) != 32123 {
+			continue // someone else's
+		}
+		require.Equal(t, uint16(33434), binary.BigEndian.Uint16(buf[2:4]))
+		checksums[binary.BigEndian.Uint16(buf[6:8])] = struct{}{}
+	}
+}
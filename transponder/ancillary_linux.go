@@ -0,0 +1,104 @@
+package transponder
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/flashbots/latency-monitor/types"
+	"golang.org/x/sys/unix"
+)
+
+func enableAncillary(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errSockopt error
+	err = raw.Control(func(fd uintptr) {
+		// the socket is either ip4 or dual-stack ip6 (where ip4 traffic is
+		// still reported via IP_TOS/IP_TTL), so we need at least one to succeed
+		for _, opts := range [][2][2]int{
+			{{unix.IPPROTO_IP, unix.IP_RECVTOS}, {unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS}},
+			{{unix.IPPROTO_IP, unix.IP_RECVTTL}, {unix.IPPROTO_IPV6, unix.IPV6_RECVHOPLIMIT}},
+		} {
+			err4 := unix.SetsockoptInt(int(fd), opts[0][0], opts[0][1], 1)
+			err6 := unix.SetsockoptInt(int(fd), opts[1][0], opts[1][1], 1)
+			if err4 != nil && err6 != nil {
+				errSockopt = err4
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return errSockopt
+}
+
+func metadataFromOOB(oob []byte) Metadata {
+	meta := Metadata{
+		DSCP: types.DSCPUnknown,
+	}
+
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return meta
+	}
+
+	for _, m := range messages {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_TOS && len(m.Data) >= 1:
+			meta.DSCP = m.Data[0] >> 2
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_TCLASS && len(m.Data) >= 4:
+			meta.DSCP = uint8(binary.NativeEndian.Uint32(m.Data) >> 2)
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_TTL && len(m.Data) >= 4:
+			meta.TTL = uint8(binary.NativeEndian.Uint32(m.Data))
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_HOPLIMIT && len(m.Data) >= 4:
+			meta.TTL = uint8(binary.NativeEndian.Uint32(m.Data))
+		}
+	}
+
+	return meta
+}
+
+func dscpToOOB(addr *net.UDPAddr, dscp uint8) []byte {
+	if dscp == 0 || !types.IsValidDSCP(dscp) { // e.g. types.DSCPUnknown
+		return nil
+	}
+
+	level, typ := unix.IPPROTO_IP, unix.IP_TOS
+	if addr.IP.To4() == nil {
+		level, typ = unix.IPPROTO_IPV6, unix.IPV6_TCLASS
+	}
+
+	oob := make([]byte, unix.CmsgSpace(4))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(unix.CmsgLen(4))
+	binary.NativeEndian.PutUint32(oob[unix.CmsgLen(0):], uint32(dscp)<<2)
+
+	return oob
+}
+
+// setDSCP marks all of the traffic sent through the socket with the dscp.
+func setDSCP(raw syscall.RawConn, ip6 bool, dscp uint8) error {
+	level, opt := unix.IPPROTO_IP, unix.IP_TOS
+	if ip6 {
+		level, opt = unix.IPPROTO_IPV6, unix.IPV6_TCLASS
+	}
+
+	var errSockopt error
+	err := raw.Control(func(fd uintptr) {
+		errSockopt = unix.SetsockoptInt(int(fd), level, opt, int(dscp)<<2)
+	})
+	if err != nil {
+		return err
+	}
+
+	return errSockopt
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package transponder
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/flashbots/latency-monitor/types"
+)
+
+func enableAncillary(_ *net.UDPConn) error {
+	return nil
+}
+
+func metadataFromOOB(_ []byte) Metadata {
+	return Metadata{
+		DSCP: types.DSCPUnknown,
+	}
+}
+
+func dscpToOOB(_ *net.UDPAddr, _ uint8) []byte {
+	return nil
+}
+
+func setDSCP(_ syscall.RawConn, _ bool, _ uint8) error {
+	return nil
+}
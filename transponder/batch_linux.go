@@ -0,0 +1,91 @@
+package transponder
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchConn reads and writes the datagrams in batches (via recvmmsg and
+// sendmmsg syscalls).
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+func (t *Transponder) batchConn(s *socket) batchConn {
+	if t.network == "udp6" {
+		return ipv6.NewPacketConn(s.conn)
+	}
+	return ipv4.NewPacketConn(s.conn)
+}
+
+func (t *Transponder) receive(idx int) error {
+	conn := t.batchConn(t.conns[idx])
+
+	messages := make([]ipv4.Message, t.batchSize)
+	for i := range messages {
+		messages[i].Buffers = [][]byte{
+			make([]byte, datagramSize),
+		}
+		messages[i].OOB = make([]byte, oobSize)
+	}
+
+	for {
+		count, err := conn.ReadBatch(messages, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages[:count] {
+			addr, ok := m.Addr.(*net.UDPAddr)
+			if !ok {
+				continue
+			}
+			meta := metadataFromOOB(m.OOB[:m.NN])
+			meta.socket = idx
+			t.Receive(t, m.Buffers[0][:m.N], addr, meta)
+		}
+	}
+}
+
+func (t *Transponder) sendReplies(s *socket) {
+	conn := t.batchConn(s)
+
+	batch := make([]reply, 0, t.batchSize)
+	messages := make([]ipv4.Message, t.batchSize)
+
+	for r := range s.replies {
+		batch = append(batch[:0], r)
+	collect: // whatever else is already waiting in the queue
+		for len(batch) < t.batchSize {
+			select {
+			case r, ok := <-s.replies:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, r)
+			default:
+				break collect
+			}
+		}
+
+		for i, r := range batch {
+			messages[i] = ipv4.Message{
+				Buffers: [][]byte{r.data},
+				OOB:     dscpToOOB(r.addr, r.dscp),
+				Addr:    r.addr,
+			}
+		}
+
+		for sent := 0; sent < len(batch); {
+			count, err := conn.WriteBatch(messages[sent:len(batch)], 0)
+			sent += count
+			if err != nil && sent < len(batch) { // skip the failed one and carry on with the rest
+				batch[sent].onError(err)
+				sent += 1
+			}
+		}
+	}
+}
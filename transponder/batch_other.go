@@ -0,0 +1,29 @@
+//go:build !linux
+
+package transponder
+
+func (t *Transponder) receive(idx int) error {
+	conn := t.conns[idx].conn
+
+	buf := make([]byte, datagramSize)
+	oob := make([]byte, oobSize)
+
+	for {
+		length, oobLength, _, addr, err := conn.ReadMsgUDP(buf, oob)
+		if err != nil {
+			return err
+		}
+
+		meta := metadataFromOOB(oob[:oobLength])
+		meta.socket = idx
+		t.Receive(t, buf[:length], addr, meta)
+	}
+}
+
+func (t *Transponder) sendReplies(s *socket) {
+	for r := range s.replies {
+		if _, _, err := s.conn.WriteMsgUDP(r.data, dscpToOOB(r.addr, r.dscp), r.addr); err != nil {
+			r.onError(err)
+		}
+	}
+}
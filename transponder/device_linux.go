@@ -0,0 +1,25 @@
+package transponder
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// BindToDevice binds the socket to the network device (if any), so that the
+// traffic goes through it regardless of the routing.
+func BindToDevice(raw syscall.RawConn, device string) error {
+	if device == "" {
+		return nil
+	}
+
+	var errSockopt error
+	err := raw.Control(func(fd uintptr) {
+		errSockopt = unix.BindToDevice(int(fd), device)
+	})
+	if err != nil {
+		return err
+	}
+
+	return errSockopt
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package transponder
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// BindToDevice binds the socket to the network device (if any), so that the
+// traffic goes through it regardless of the routing.
+func BindToDevice(_ syscall.RawConn, device string) error {
+	if device == "" {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s",
+		ErrBindToDeviceNotSupported, device,
+	)
+}
@@ -0,0 +1,31 @@
+package transponder
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/latency-monitor/types"
+)
+
+// NewDialer returns the dialer for the connection-oriented probes, that
+// connects from the source address and/or device, and marks the traffic with
+// the dscp.
+func NewDialer(source types.Source, dscp uint8, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, _ string, raw syscall.RawConn) error {
+			if err := BindToDevice(raw, source.Device); err != nil {
+				return err
+			}
+			if dscp == 0 {
+				return nil
+			}
+			return setDSCP(raw, network == "tcp6" || network == "udp6", dscp)
+		},
+	}
+	if source.IP != nil {
+		d.LocalAddr = &net.TCPAddr{IP: source.IP}
+	}
+	return d
+}
@@ -0,0 +1,194 @@
+package transponder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/types"
+	"go.uber.org/zap"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Pinger sends icmp echo requests and receives the replies to them.  It uses
+// unprivileged (datagram) icmp sockets where the platform permits, and falls
+// back to the raw ones otherwise.
+type Pinger struct {
+	Receive PingReceive
+
+	name    string
+	network string // ip4 or ip6
+	ip      net.IP
+	device  string
+
+	id           int
+	conn         net.PacketConn
+	raw          bool
+	mx           sync.Mutex
+	shuttingDown bool
+}
+
+type PingReceive = func(p *Pinger, data []byte, from net.IP)
+
+var (
+	ErrPingerNotRunning = errors.New("pinger is not running")
+)
+
+var pingerID atomic.Uint32
+
+// NewPinger creates a pinger that sends the echo requests of the network
+// (ip4 or ip6) from the source address and/or device.
+func NewPinger(network string, source types.Source) *Pinger {
+	ip := source.IP
+	if ip == nil {
+		ip = net.IPv4zero
+		if network == "ip6" {
+			ip = net.IPv6unspecified
+		}
+	}
+
+	name := network
+	if !source.IsZero() {
+		name += "/" + source.String()
+	}
+
+	return &Pinger{
+		name:    name,
+		network: network,
+		ip:      ip,
+		device:  source.Device,
+
+		// only matters with raw sockets (the kernel assigns it to datagram ones)
+		id: (os.Getpid() + int(pingerID.Add(1))) & 0xffff,
+	}
+}
+
+func (p *Pinger) Name() string {
+	return p.name
+}
+
+func (p *Pinger) IsRunning() bool {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return !p.shuttingDown && p.conn != nil
+}
+
+func (p *Pinger) Run(ctx context.Context) error {
+	p.mx.Lock()
+	if p.conn != nil {
+		p.mx.Unlock()
+		return ErrAlreadyServing
+	}
+	conn, raw, err := listenICMP(p.network, p.ip, p.device)
+	if err != nil {
+		p.mx.Unlock()
+		return err
+	}
+	p.conn, p.raw = conn, raw
+	p.mx.Unlock()
+
+	l := logutils.LoggerFromContext(ctx)
+	if raw {
+		l.Info("Unprivileged icmp sockets are not permitted, using the raw one",
+			zap.String("pinger", p.name),
+		)
+	}
+
+	proto, reply := ipv4.ICMPTypeEchoReply.Protocol(), icmp.Type(ipv4.ICMPTypeEchoReply)
+	if p.network == "ip6" {
+		proto, reply = ipv6.ICMPTypeEchoReply.Protocol(), ipv6.ICMPTypeEchoReply
+	}
+
+	buf := make([]byte, datagramSize)
+	for {
+		length, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if p.shuttingDown {
+				return nil
+			}
+			l.Error("Error while reading ICMP",
+				zap.Error(err),
+			)
+			return err
+		}
+
+		m, err := icmp.ParseMessage(proto, buf[:length])
+		if err != nil || m.Type != reply {
+			continue // raw sockets receive all of the icmp traffic
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		if !ok || (raw && echo.ID != p.id) {
+			continue
+		}
+
+		var from net.IP
+		switch addr := addr.(type) {
+		case *net.UDPAddr:
+			from = addr.IP
+		case *net.IPAddr:
+			from = addr.IP
+		}
+
+		p.Receive(p, echo.Data, from)
+	}
+}
+
+func (p *Pinger) Shutdown(ctx context.Context) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.shuttingDown = true
+	if p.conn == nil {
+		return nil
+	}
+	if err := p.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Send sends the echo request with the data as its payload.  Send must not be
+// invoked concurrently.
+func (p *Pinger) Send(ip net.IP, seq int, data []byte, dscp uint8) error {
+	p.mx.Lock()
+	conn, raw := p.conn, p.raw
+	p.mx.Unlock()
+	if conn == nil {
+		return ErrPingerNotRunning
+	}
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if p.network == "ip6" {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+
+	b, err := (&icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  seq & 0xffff,
+			Data: data,
+		},
+	}).Marshal(nil) // the kernel computes ip6 checksum
+	if err != nil {
+		return err
+	}
+
+	if err := setTOS(conn, p.network, dscp); err != nil {
+		return err
+	}
+
+	var addr net.Addr = &net.UDPAddr{IP: ip}
+	if raw {
+		addr = &net.IPAddr{IP: ip}
+	}
+	_, err = conn.WriteTo(b, addr)
+	return err
+}
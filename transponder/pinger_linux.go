@@ -0,0 +1,82 @@
+package transponder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenICMP opens the icmp socket (preferring the unprivileged one), and
+// tells whether it is a raw one.
+func listenICMP(network string, ip net.IP, device string) (net.PacketConn, bool, error) {
+	conn, err := listenICMPDatagram(network, ip, device)
+	if err == nil {
+		return conn, false, nil
+	}
+	if !errors.Is(err, unix.EACCES) && !errors.Is(err, unix.EPERM) && !errors.Is(err, unix.EPROTONOSUPPORT) {
+		return nil, false, err
+	}
+
+	proto := ":icmp"
+	if network == "ip6" {
+		proto = ":ipv6-icmp"
+	}
+	lc := net.ListenConfig{
+		Control: func(_, _ string, raw syscall.RawConn) error {
+			return BindToDevice(raw, device)
+		},
+	}
+	conn, err = lc.ListenPacket(context.Background(), network+proto, ip.String())
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+func listenICMPDatagram(network string, ip net.IP, device string) (net.PacketConn, error) {
+	family, proto := unix.AF_INET, unix.IPPROTO_ICMP
+	var sa unix.Sockaddr = &unix.SockaddrInet4{}
+	if network == "ip6" {
+		family, proto = unix.AF_INET6, unix.IPPROTO_ICMPV6
+		sa6 := &unix.SockaddrInet6{}
+		copy(sa6.Addr[:], ip.To16())
+		sa = sa6
+	} else {
+		copy(sa.(*unix.SockaddrInet4).Addr[:], ip.To4())
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("icmp:%s", ip))
+	defer f.Close() // net.FilePacketConn duplicates the descriptor
+
+	if device != "" {
+		if err := unix.BindToDevice(fd, device); err != nil {
+			return nil, err
+		}
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		return nil, err
+	}
+
+	return net.FilePacketConn(f)
+}
+
+func setTOS(conn net.PacketConn, network string, dscp uint8) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return setDSCP(raw, network == "ip6", dscp)
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+
+package transponder
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/net/icmp"
+)
+
+// listenICMP opens the icmp socket (preferring the unprivileged one), and
+// tells whether it is a raw one.
+func listenICMP(network string, ip net.IP, device string) (net.PacketConn, bool, error) {
+	if device != "" {
+		return nil, false, fmt.Errorf("%w: %s",
+			ErrBindToDeviceNotSupported, device,
+		)
+	}
+
+	proto := ":icmp"
+	if network == "ip6" {
+		proto = ":ipv6-icmp"
+	}
+
+	if conn, err := icmp.ListenPacket("udp"+network[2:], ip.String()); err == nil {
+		return conn, false, nil
+	}
+	conn, err := icmp.ListenPacket(network+proto, ip.String())
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+func setTOS(_ net.PacketConn, _ string, _ uint8) error {
+	return nil
+}
@@ -0,0 +1,360 @@
+package transponder
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrQUICNotConnected = errors.New("quic connection is not established")
+)
+
+const (
+	quicALPN        = "latency-monitor"
+	quicIdleTimeout = 30 * time.Second
+
+	quicErrorRejected quic.ApplicationErrorCode = 1 // the connection is not accepted
+)
+
+// QUICListener accepts the quic connections of the others and passes the
+// datagrams received over them to Receive.
+type QUICListener struct {
+	Accept  func(addr net.Addr) bool // tells whether to accept the connection (all if nil)
+	Receive ConnReceive
+
+	listenAddress string
+
+	transport    *quic.Transport
+	mx           sync.Mutex
+	shuttingDown bool
+}
+
+// QUICDialer maintains quic connection to the peer (re-dialing it upon
+// failures), and passes the datagrams received over it to Receive.
+type QUICDialer struct {
+	Receive     ConnReceive
+	OnReconnect func() // invoked whenever the connection is re-established
+
+	name    string
+	peer    *types.Peer
+	timeout time.Duration
+
+	conn         quic.Connection
+	transport    *quic.Transport
+	smoothedRTT  atomic.Int64
+	mx           sync.Mutex
+	shuttingDown bool
+}
+
+func NewQUICListener(listenAddress string) (*QUICListener, error) {
+	if _, err := net.ResolveUDPAddr("udp", listenAddress); err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			ErrMalformedListenAddress, err,
+		)
+	}
+
+	return &QUICListener{
+		listenAddress: listenAddress,
+	}, nil
+}
+
+func (l *QUICListener) Name() string {
+	return l.listenAddress
+}
+
+func (l *QUICListener) Run(ctx context.Context) error {
+	logger := logutils.LoggerFromContext(ctx)
+
+	tlsConfig, err := selfSignedTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", l.listenAddress)
+	if err != nil {
+		return err
+	}
+
+	l.mx.Lock()
+	if l.shuttingDown {
+		l.mx.Unlock()
+		conn.Close()
+		return nil
+	}
+	l.transport = &quic.Transport{Conn: conn}
+	l.mx.Unlock()
+
+	listener, err := l.transport.Listen(tlsConfig, quicConfig(nil))
+	if err != nil {
+		return err
+	}
+
+	for {
+		qconn, err := listener.Accept(ctx)
+		if err != nil {
+			if l.shuttingDown {
+				return nil
+			}
+			logger.Error("Error while accepting QUIC connection",
+				zap.Error(err),
+			)
+			return err
+		}
+
+		if l.Accept != nil && !l.Accept(qconn.RemoteAddr()) {
+			_ = qconn.CloseWithError(quicErrorRejected, "rejected")
+			continue
+		}
+
+		go func() {
+			for {
+				data, err := qconn.ReceiveDatagram(ctx)
+				if err != nil {
+					return // the connection is closed
+				}
+				l.Receive(l.listenAddress, data, qconn.RemoteAddr(), sendDatagram(qconn))
+			}
+		}()
+	}
+}
+
+func (l *QUICListener) Shutdown(ctx context.Context) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.shuttingDown = true
+	if l.transport == nil {
+		return nil
+	}
+	return l.transport.Close()
+}
+
+// NewQUICDialer creates a dialer that connects to the peer from its source
+// address and/or device.  Any failures of the connection are reported as
+// errors of Send until it is re-established.
+func NewQUICDialer(peer *types.Peer, timeout time.Duration) *QUICDialer {
+	return &QUICDialer{
+		name:    peer.Name(),
+		peer:    peer,
+		timeout: timeout,
+	}
+}
+
+func (d *QUICDialer) Name() string {
+	return d.name
+}
+
+func (d *QUICDialer) Run(ctx context.Context) error {
+	l := logutils.LoggerFromContext(ctx)
+
+	conn, err := listenSource(d.peer.Source())
+	if err != nil {
+		return err
+	}
+
+	d.mx.Lock()
+	if d.shuttingDown {
+		d.mx.Unlock()
+		conn.Close()
+		return nil
+	}
+	d.transport = &quic.Transport{Conn: conn}
+	d.mx.Unlock()
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true, // the listeners' certificates are self-signed
+		NextProtos:         []string{quicALPN},
+	}
+	config := quicConfig(&logging.ConnectionTracer{
+		UpdatedMetrics: func(rttStats *logging.RTTStats, _, _ logging.ByteCount, _ int) {
+			d.smoothedRTT.Store(int64(rttStats.SmoothedRTT()))
+		},
+	})
+
+	connected := false
+	for !d.isShuttingDown() {
+		qconn, err := d.dial(ctx, tlsConfig, config)
+		if err != nil {
+			if d.isShuttingDown() {
+				break
+			}
+			l.Warn("Failed to establish QUIC connection",
+				zap.Error(err),
+				zap.String("peer", d.name),
+			)
+			time.Sleep(redialDelay)
+			continue
+		}
+
+		d.mx.Lock()
+		d.conn = qconn
+		d.mx.Unlock()
+		if connected && d.OnReconnect != nil {
+			d.OnReconnect()
+		}
+		connected = true
+
+		for {
+			data, err := qconn.ReceiveDatagram(ctx)
+			if err != nil {
+				if !d.isShuttingDown() {
+					l.Warn("QUIC connection is lost",
+						zap.Error(err),
+						zap.String("peer", d.name),
+					)
+				}
+				break
+			}
+			d.Receive(d.name, data, qconn.RemoteAddr(), sendDatagram(qconn))
+		}
+
+		d.mx.Lock()
+		d.conn = nil
+		d.mx.Unlock()
+	}
+
+	return nil
+}
+
+func (d *QUICDialer) dial(ctx context.Context, tlsConfig *tls.Config, config *quic.Config) (quic.Connection, error) {
+	addr, err := d.peer.UDPAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	return d.transport.Dial(ctx, addr, tlsConfig, config)
+}
+
+func (d *QUICDialer) Shutdown(ctx context.Context) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.shuttingDown = true
+	if d.transport == nil {
+		return nil
+	}
+	return d.transport.Close()
+}
+
+func (d *QUICDialer) isShuttingDown() bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.shuttingDown
+}
+
+// IsConnected tells whether the connection to the peer is established.
+func (d *QUICDialer) IsConnected() bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.conn != nil
+}
+
+// Send sends the data to the peer in quic datagram.
+func (d *QUICDialer) Send(data []byte) error {
+	d.mx.Lock()
+	conn := d.conn
+	d.mx.Unlock()
+
+	if conn == nil {
+		return ErrQUICNotConnected
+	}
+	return conn.SendDatagram(data)
+}
+
+// SmoothedRTT is the round-trip time of the connection as estimated by quic
+// itself (zero until it is established).
+func (d *QUICDialer) SmoothedRTT() time.Duration {
+	return time.Duration(d.smoothedRTT.Load())
+}
+
+func quicConfig(tracer *logging.ConnectionTracer) *quic.Config {
+	config := &quic.Config{
+		EnableDatagrams: true,
+		KeepAlivePeriod: quicIdleTimeout / 3,
+		MaxIdleTimeout:  quicIdleTimeout,
+	}
+	if tracer != nil {
+		config.Tracer = func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+			return tracer
+		}
+	}
+	return config
+}
+
+// sendDatagram returns the send of ConnReceive for the connection.  The dscp is
+// ignored, since quic-go marks every packet with the ecn of its own (which
+// wipes out the rest of the tos).
+func sendDatagram(qconn quic.Connection) func([]byte, uint8) error {
+	return func(data []byte, _ uint8) error {
+		return qconn.SendDatagram(data)
+	}
+}
+
+// listenSource opens udp socket bound to the source address and/or device on
+// an ephemeral port.
+func listenSource(source types.Source) (net.PacketConn, error) {
+	ip := source.IP
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+
+	lc := net.ListenConfig{
+		Control: func(_, _ string, raw syscall.RawConn) error {
+			return BindToDevice(raw, source.Device)
+		},
+	}
+	return lc.ListenPacket(context.Background(), "udp", net.JoinHostPort(ip.String(), "0"))
+}
+
+// selfSignedTLSConfig returns tls config with ephemeral self-signed
+// certificate.  The probes do not need any confidentiality, but quic can not
+// do without tls.
+func selfSignedTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: quicALPN},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+		NextProtos: []string{quicALPN},
+	}, nil
+}
@@ -0,0 +1,47 @@
+package transponder
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func reusePort(raw syscall.RawConn) error {
+	var errSockopt error
+	err := raw.Control(func(fd uintptr) {
+		errSockopt = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return errSockopt
+}
+
+// pinToCPU pins the calling thread to the idx-th (modulo count) cpu out of
+// those the process is allowed to run on.
+func pinToCPU(idx int) error {
+	allowed := unix.CPUSet{}
+	if err := unix.SchedGetaffinity(0, &allowed); err != nil {
+		return err
+	}
+
+	count := allowed.Count()
+	if count == 0 {
+		return fmt.Errorf("no cpus to pin to")
+	}
+
+	for cpu, n := 0, idx%count; ; cpu++ {
+		if !allowed.IsSet(cpu) {
+			continue
+		}
+		if n > 0 {
+			n--
+			continue
+		}
+		pinned := unix.CPUSet{}
+		pinned.Set(cpu)
+		return unix.SchedSetaffinity(0, &pinned)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package transponder
+
+import (
+	"syscall"
+)
+
+func reusePort(_ syscall.RawConn) error {
+	return ErrReusePortNotSupported
+}
+
+func pinToCPU(_ int) error {
+	return nil
+}
@@ -0,0 +1,354 @@
+package transponder
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/latency-monitor/logutils"
+	"github.com/flashbots/latency-monitor/types"
+	"go.uber.org/zap"
+)
+
+// The probes are exchanged over tcp streams as frames prefixed with their
+// length (2 bytes, big-endian).
+
+var (
+	ErrStreamFrameTooLarge = errors.New("tcp stream frame is too large")
+	ErrStreamNotConnected  = errors.New("tcp stream is not established")
+)
+
+// StreamListener accepts the tcp streams of the others and passes the probes
+// received over them to Receive.  The streams that stay idle for longer than
+// the idle timeout are closed.
+type StreamListener struct {
+	Accept  func(addr net.Addr) bool // tells whether to accept the stream (all if nil)
+	Receive ConnReceive
+
+	listenAddress string
+	idleTimeout   time.Duration
+
+	listener     net.Listener
+	conns        map[net.Conn]struct{}
+	mx           sync.Mutex
+	shuttingDown bool
+}
+
+// StreamDialer maintains tcp stream to the peer (re-dialing it upon
+// failures), and passes the probes received over it to Receive.
+type StreamDialer struct {
+	Receive     ConnReceive
+	OnReconnect func() // invoked whenever the stream is re-established
+
+	name    string
+	peer    *types.Peer
+	timeout time.Duration
+
+	conn         *streamConn
+	mx           sync.Mutex
+	shuttingDown bool
+}
+
+// streamConn serialises the writes of the frames.
+type streamConn struct {
+	net.Conn
+	dscp uint8 // the stream is currently marked with
+	mx   sync.Mutex
+}
+
+func NewStreamListener(listenAddress string, idleTimeout time.Duration) (*StreamListener, error) {
+	if _, err := net.ResolveTCPAddr("tcp", listenAddress); err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			ErrMalformedListenAddress, err,
+		)
+	}
+
+	return &StreamListener{
+		listenAddress: listenAddress,
+		idleTimeout:   idleTimeout,
+		conns:         make(map[net.Conn]struct{}),
+	}, nil
+}
+
+func (l *StreamListener) Name() string {
+	return l.listenAddress
+}
+
+func (l *StreamListener) Run(ctx context.Context) error {
+	logger := logutils.LoggerFromContext(ctx)
+
+	listener, err := net.Listen("tcp", l.listenAddress)
+	if err != nil {
+		return err
+	}
+
+	l.mx.Lock()
+	if l.shuttingDown {
+		l.mx.Unlock()
+		listener.Close()
+		return nil
+	}
+	l.listener = listener
+	l.mx.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if l.shuttingDown {
+				return nil
+			}
+			logger.Error("Error while accepting TCP stream",
+				zap.Error(err),
+			)
+			return err
+		}
+
+		if l.Accept != nil && !l.Accept(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+
+		l.mx.Lock()
+		l.conns[conn] = struct{}{}
+		l.mx.Unlock()
+
+		go func() {
+			sc := &streamConn{Conn: conn}
+			_ = sc.readFrames(l.idleTimeout, func(data []byte) {
+				l.Receive(l.listenAddress, data, conn.RemoteAddr(), sc.reply)
+			})
+
+			l.mx.Lock()
+			delete(l.conns, conn)
+			l.mx.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (l *StreamListener) Shutdown(ctx context.Context) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.shuttingDown = true
+	if l.listener == nil {
+		return nil
+	}
+	errs := []error{l.listener.Close()}
+	for conn := range l.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// NewStreamDialer creates a dialer that connects to the peer from its source
+// address and/or device (with the traffic marked with the peer's dscp).
+func NewStreamDialer(peer *types.Peer, timeout time.Duration) *StreamDialer {
+	return &StreamDialer{
+		name:    peer.Name(),
+		peer:    peer,
+		timeout: timeout,
+	}
+}
+
+func (d *StreamDialer) Name() string {
+	return d.name
+}
+
+func (d *StreamDialer) Run(ctx context.Context) error {
+	l := logutils.LoggerFromContext(ctx)
+
+	dialer := NewDialer(d.peer.Source(), d.peer.DSCP(), d.timeout)
+
+	connected := false
+	for !d.isShuttingDown() {
+		conn, err := d.dial(ctx, dialer)
+		if err != nil {
+			l.Warn("Failed to establish TCP stream",
+				zap.Error(err),
+				zap.String("peer", d.name),
+			)
+			time.Sleep(redialDelay)
+			continue
+		}
+
+		sc := &streamConn{Conn: conn}
+		d.mx.Lock()
+		if d.shuttingDown {
+			d.mx.Unlock()
+			conn.Close()
+			break
+		}
+		d.conn = sc
+		d.mx.Unlock()
+		if connected && d.OnReconnect != nil {
+			d.OnReconnect()
+		}
+		connected = true
+
+		err = sc.readFrames(0, func(data []byte) {
+			d.Receive(d.name, data, conn.RemoteAddr(), func(data []byte, _ uint8) error {
+				return sc.writeFrame(data) // marked with the peer's dscp already
+			})
+		})
+		if !d.isShuttingDown() {
+			l.Warn("TCP stream is lost",
+				zap.Error(err),
+				zap.String("peer", d.name),
+			)
+		}
+
+		d.mx.Lock()
+		d.conn = nil
+		d.mx.Unlock()
+		conn.Close()
+	}
+
+	return nil
+}
+
+func (d *StreamDialer) dial(ctx context.Context, dialer *net.Dialer) (net.Conn, error) {
+	addr, err := d.peer.UDPAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	return dialer.DialContext(ctx, "tcp", (&net.TCPAddr{IP: addr.IP, Port: addr.Port}).String())
+}
+
+func (d *StreamDialer) Shutdown(ctx context.Context) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.shuttingDown = true
+	if d.conn == nil {
+		return nil
+	}
+	return d.conn.Close()
+}
+
+func (d *StreamDialer) isShuttingDown() bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.shuttingDown
+}
+
+// IsConnected tells whether the stream to the peer is established.
+func (d *StreamDialer) IsConnected() bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.conn != nil
+}
+
+// Send sends the data to the peer as a frame of the stream.
+func (d *StreamDialer) Send(data []byte) error {
+	d.mx.Lock()
+	conn := d.conn
+	d.mx.Unlock()
+
+	if conn == nil {
+		return ErrStreamNotConnected
+	}
+	return conn.writeFrame(data)
+}
+
+func (c *streamConn) writeFrame(data []byte) error {
+	frame, err := newFrame(data)
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	_, err = c.Write(frame)
+	return err
+}
+
+// reply sends the data back as a frame of the stream, with the stream marked
+// with the dscp (just as the replies to the udp probes are).
+func (c *streamConn) reply(data []byte, dscp uint8) error {
+	if !types.IsValidDSCP(dscp) { // e.g. types.DSCPUnknown
+		dscp = 0
+	}
+
+	frame, err := newFrame(data)
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if dscp != c.dscp {
+		if err := c.mark(dscp); err != nil {
+			return err
+		}
+		c.dscp = dscp
+	}
+
+	_, err = c.Write(frame)
+	return err
+}
+
+func newFrame(data []byte) ([]byte, error) {
+	if len(data) > datagramSize {
+		return nil, fmt.Errorf("%w: %d bytes",
+			ErrStreamFrameTooLarge, len(data),
+		)
+	}
+
+	frame := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	copy(frame[2:], data)
+
+	return frame, nil
+}
+
+func (c *streamConn) mark(dscp uint8) error {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	addr, ok := c.RemoteAddr().(*net.TCPAddr)
+	return setDSCP(raw, ok && addr.IP.To4() == nil, dscp)
+}
+
+// readFrames reads the frames until the stream fails or stays idle for longer
+// than the timeout (if any).
+func (c *streamConn) readFrames(idleTimeout time.Duration, receive func(data []byte)) error {
+	header := make([]byte, 2)
+	buf := make([]byte, datagramSize)
+	for {
+		if idleTimeout > 0 {
+			if err := c.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.ReadFull(c, header); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(header))
+		if length > len(buf) {
+			return fmt.Errorf("%w: %d bytes",
+				ErrStreamFrameTooLarge, length,
+			)
+		}
+		if _, err := io.ReadFull(c, buf[:length]); err != nil {
+			return err
+		}
+		receive(buf[:length])
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"strconv"
-	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/flashbots/latency-monitor/config"
 	"github.com/flashbots/latency-monitor/logutils"
@@ -18,114 +20,330 @@ import (
 type Transponder struct {
 	Receive Receive
 
-	ip   net.IP
-	port int
+	name    string
+	network string
+	ip      net.IP
+	port    int
+	device  string
 
-	conn         *net.UDPConn
+	batchSize int
+	workers   int
+	sockets   int
+
+	conns        []*socket
 	mx           sync.Mutex
 	shuttingDown bool
 }
 
-type Receive = func(t *Transponder, b []byte, addr *net.UDPAddr)
+type Receive = func(t *Transponder, b []byte, addr *net.UDPAddr, meta Metadata)
+
+// ConnReceive is invoked for every probe received over a connection (quic or
+// tcp stream).  The reply (if any) is to be sent back via send, along with the
+// dscp to mark it with (quic can not do that).
+type ConnReceive = func(name string, data []byte, addr net.Addr, send func(data []byte, dscp uint8) error)
+
+// socket is one of the (SO_REUSEPORT) sockets of the transponder, with its
+// own reader and reply workers.
+type socket struct {
+	conn    *net.UDPConn
+	replies chan reply
+}
+
+type reply struct {
+	data    []byte
+	addr    *net.UDPAddr
+	dscp    uint8
+	onError func(error)
+}
+
+// Metadata is the ancillary data received along with a datagram.
+type Metadata struct {
+	// DSCP is the differentiated services code point the datagram was
+	// received with (types.DSCPUnknown if the platform does not report it).
+	DSCP uint8
+
+	// TTL is the time-to-live (or hop limit) the datagram was received with
+	// (zero if the platform does not report it).
+	TTL uint8
+
+	socket int // index of the socket the datagram was received on
+}
 
 var (
-	ErrAlreadyServing         = errors.New("probe-responder is already serving")
-	ErrMalformedListenAddress = errors.New("malformed listen address")
+	ErrAlreadyServing           = errors.New("probe-responder is already serving")
+	ErrBindToDeviceNotSupported = errors.New("binding to a device is not supported on this platform")
+	ErrMalformedListenAddress   = errors.New("malformed listen address")
+	ErrReplyQueueFull           = errors.New("reply queue is full")
+	ErrReusePortNotSupported    = errors.New("multiple sockets per listen address are not supported on this platform")
 )
 
-func New(cfg *config.Transponder) (*Transponder, error) {
-	parts := strings.Split(cfg.ListenAddress, ":")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("%w: %s",
-			ErrMalformedListenAddress, cfg.ListenAddress,
+const (
+	datagramSize = 1500 // must fit the largest of the probes (incl. padded twamp ones)
+	oobSize      = 64   // must fit the control messages we enable
+
+	redialDelay = time.Second // between the attempts to re-establish a connection
+)
+
+// New creates a transponder that listens on the address.  The unspecified
+// address (e.g. 0.0.0.0) is listened on with the dual-stack socket, whereas the
+// explicit IPv4 and IPv6 ones get the sockets of their own family.
+func New(cfg *config.Transponder, listenAddress string) (*Transponder, error) {
+	host, strPort, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			ErrMalformedListenAddress, err,
 		)
 	}
 
-	ip := net.ParseIP(parts[0])
+	ip := net.ParseIP(host)
 	if ip == nil {
 		return nil, fmt.Errorf("%w: %s",
-			ErrMalformedListenAddress, cfg.ListenAddress,
+			ErrMalformedListenAddress, listenAddress,
 		)
 	}
 
-	port, err := strconv.Atoi(parts[1])
+	port, err := strconv.Atoi(strPort)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w",
 			ErrMalformedListenAddress, err,
 		)
 	}
 
+	network := "udp"
+	switch {
+	case ip.IsUnspecified():
+		// dual-stack
+	case ip.To4() != nil:
+		network = "udp4"
+	default:
+		network = "udp6"
+	}
+
+	return &Transponder{
+		name:    listenAddress,
+		network: network,
+		ip:      ip,
+		port:    port,
+
+		batchSize: cfg.BatchSize,
+		workers:   cfg.ReplyWorkers,
+		sockets:   cfg.Sockets,
+	}, nil
+}
+
+// NewSource creates a transponder that is bound to the source address and/or
+// device on an ephemeral port, so that the probes sent through it (as well as
+// their returns) take the corresponding path.
+func NewSource(cfg *config.Transponder, source types.Source) (*Transponder, error) {
+	ip := source.IP
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+
 	return &Transponder{
-		ip:   ip,
-		port: port,
+		name:    source.String(),
+		network: "udp",
+		ip:      ip,
+		port:    0,
+		device:  source.Device,
+
+		batchSize: cfg.BatchSize,
+		workers:   cfg.ReplyWorkers,
+		sockets:   1, // only our own probes return here
 	}, nil
 }
 
+// Name is the listen address of the transponder (or its source, if the
+// transponder was created with NewSource).
+func (t *Transponder) Name() string {
+	return t.name
+}
+
 func (t *Transponder) Shutdown(ctx context.Context) error {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
-	if t.conn != nil {
-		t.shuttingDown = true
-		return t.conn.Close()
-	}
-	return nil
+	t.shuttingDown = true
+	return t.closeConnections()
 }
 
 func (t *Transponder) Run(ctx context.Context) error {
-	if err := t.setupConnection(); err != nil {
+	if err := t.setupConnections(); err != nil {
 		return err
 	}
 
 	l := logutils.LoggerFromContext(ctx)
 
-	buf := make([]byte, types.ProbeSize()) // must be larger than encoded Probe size
+	errs := make(chan error, len(t.conns))
+	for idx := range t.conns {
+		go func() {
+			errs <- t.serve(ctx, idx)
+		}()
+	}
 
-	for {
-		length, addr, err := t.conn.ReadFromUDP(buf)
-		if err != nil {
-			if t.shuttingDown {
-				return nil
-			}
-			l.Error("Error while reading UDP",
+	var err error
+	for range t.conns {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			t.mx.Lock()
+			_ = t.closeConnections() // bring the other sockets down as well
+			t.mx.Unlock()
+		}
+	}
+
+	if err != nil {
+		if t.shuttingDown {
+			return nil
+		}
+		l.Error("Error while reading UDP",
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (t *Transponder) serve(ctx context.Context, idx int) error {
+	if len(t.conns) > 1 { // spread the readers across the cores
+		runtime.LockOSThread() // the thread exits along with the goroutine
+		if err := pinToCPU(idx); err != nil {
+			logutils.LoggerFromContext(ctx).Warn("Failed to pin transponder reader to a cpu",
 				zap.Error(err),
+				zap.Int("socket", idx),
 			)
-			return err
 		}
+	}
+
+	s := t.conns[idx]
 
-		t.Receive(t, buf[:length], addr)
+	wg := sync.WaitGroup{}
+	for i := 0; i < t.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.sendReplies(s)
+		}()
 	}
+
+	err := t.receive(idx)
+
+	close(s.replies) // Reply is only invoked from within Receive
+	wg.Wait()
+
+	return err
 }
 
 func (t *Transponder) IsRunning() bool {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
-	return !t.shuttingDown && t.conn != nil
+	return !t.shuttingDown && len(t.conns) > 0
 }
 
-func (t *Transponder) setupConnection() error {
+// LocalAddr returns the address the transponder is bound to (or nil, if it
+// is not running).
+func (t *Transponder) LocalAddr() *net.UDPAddr {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
-	if t.conn != nil {
+	if len(t.conns) == 0 {
+		return nil
+	}
+	return t.conns[0].conn.LocalAddr().(*net.UDPAddr)
+}
+
+// CanSendTo tells whether the address is of the family the transponder
+// is listening on.
+func (t *Transponder) CanSendTo(addr *net.UDPAddr) bool {
+	switch t.network {
+	case "udp4":
+		return addr.IP.To4() != nil
+	case "udp6":
+		return addr.IP.To4() == nil
+	default:
+		return true
+	}
+}
+
+func (t *Transponder) setupConnections() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if len(t.conns) > 0 {
 		return ErrAlreadyServing
 	}
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{
-		IP:   t.ip,
-		Port: t.port,
-	})
-	if err != nil {
-		return err
+	port := t.port
+	for i := 0; i < t.sockets; i++ {
+		conn, err := t.listen(port)
+		if err != nil {
+			_ = t.closeConnections()
+			t.conns = nil
+			return err
+		}
+		port = conn.LocalAddr().(*net.UDPAddr).Port // in case it was ephemeral
+
+		t.conns = append(t.conns, &socket{
+			conn:    conn,
+			replies: make(chan reply, t.batchSize*t.workers),
+		})
 	}
 
-	t.conn = conn
 	return nil
 }
 
-func (t *Transponder) Send(data []byte, addr *net.UDPAddr, onError func(error)) {
-	if _, err := t.conn.WriteToUDP(data, addr); err != nil {
+func (t *Transponder) listen(port int) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, raw syscall.RawConn) error {
+			if t.sockets > 1 {
+				if err := reusePort(raw); err != nil {
+					return err
+				}
+			}
+			return BindToDevice(raw, t.device)
+		},
+	}
+	pc, err := lc.ListenPacket(context.Background(), t.network,
+		net.JoinHostPort(t.ip.String(), strconv.Itoa(port)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+
+	if err := enableAncillary(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (t *Transponder) closeConnections() error {
+	var errs []error
+	for _, s := range t.conns {
+		if err := s.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Transponder) Send(data []byte, addr *net.UDPAddr, dscp uint8, onError func(error)) {
+	if _, _, err := t.conns[0].conn.WriteMsgUDP(data, dscpToOOB(addr, dscp), addr); err != nil {
 		onError(err)
 	}
 }
+
+// Reply queues the datagram to be sent by one of the reply workers of the
+// socket the original datagram was received on (as per its meta).  If the
+// queue is full, the datagram is dropped and onError is invoked with
+// ErrReplyQueueFull.  Reply must only be invoked from within Receive.
+func (t *Transponder) Reply(meta Metadata, data []byte, addr *net.UDPAddr, dscp uint8, onError func(error)) {
+	select {
+	case t.conns[meta.socket].replies <- reply{data: data, addr: addr, dscp: dscp, onError: onError}:
+	default:
+		onError(ErrReplyQueueFull)
+	}
+}
@@ -0,0 +1,190 @@
+package transponder_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/config"
+	"github.com/flashbots/latency-monitor/transponder"
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/stretchr/testify/require"
+)
+
+func runTransponder(tb testing.TB, t *transponder.Transponder) {
+	go func() {
+		_ = t.Run(context.Background())
+	}()
+	tb.Cleanup(func() {
+		_ = t.Shutdown(context.Background())
+	})
+	require.Eventually(tb, t.IsRunning, time.Second, time.Millisecond)
+}
+
+// newLoopback returns a pair of initiator and responder transponders on the
+// loopback, with the responder echoing everything it receives.
+func newLoopback(tb testing.TB, cfg *config.Transponder) (
+	initiator, responder *transponder.Transponder,
+) {
+	responder, err := transponder.New(cfg, "127.0.0.1:0")
+	require.NoError(tb, err)
+	responder.Receive = func(t *transponder.Transponder, b []byte, addr *net.UDPAddr, meta transponder.Metadata) {
+		t.Reply(meta, slices.Clone(b), addr, meta.DSCP, func(err error) {
+			if !errors.Is(err, transponder.ErrReplyQueueFull) { // that one is reported as a loss
+				tb.Errorf("failed to reply: %v", err)
+			}
+		})
+	}
+	runTransponder(tb, responder)
+
+	initiator, err = transponder.NewSource(cfg, types.Source{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(tb, err)
+
+	return initiator, responder
+}
+
+func TestTransponderReply(t *testing.T) {
+	initiator, responder := newLoopback(t, &config.Transponder{
+		BatchSize:    4,
+		ReplyWorkers: 1,
+		Sockets:      1,
+	})
+
+	type received struct {
+		data []byte
+		meta transponder.Metadata
+	}
+	returned := make(chan received, 1)
+	initiator.Receive = func(_ *transponder.Transponder, b []byte, _ *net.UDPAddr, meta transponder.Metadata) {
+		returned <- received{data: slices.Clone(b), meta: meta}
+	}
+	runTransponder(t, initiator)
+
+	initiator.Send([]byte("probe"), responder.LocalAddr(), 46, func(err error) {
+		t.Errorf("failed to send: %v", err)
+	})
+
+	select {
+	case r := <-returned:
+		require.Equal(t, []byte("probe"), r.data)
+		if r.meta.DSCP != types.DSCPUnknown {
+			require.Equal(t, uint8(46), r.meta.DSCP)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("probe did not return")
+	}
+}
+
+func TestTransponderReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("multiple sockets per listen address are only supported on linux")
+	}
+
+	const initiatorsCount = 16
+
+	cfg := &config.Transponder{
+		BatchSize:    4,
+		ReplyWorkers: 1,
+		Sockets:      4,
+	}
+	_, responder := newLoopback(t, cfg)
+
+	returned := make(chan struct{}, initiatorsCount)
+	for i := 0; i < initiatorsCount; i++ { // kernel spreads them by source port
+		initiator, err := transponder.NewSource(cfg, types.Source{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		initiator.Receive = func(_ *transponder.Transponder, _ []byte, _ *net.UDPAddr, _ transponder.Metadata) {
+			returned <- struct{}{}
+		}
+		runTransponder(t, initiator)
+
+		initiator.Send([]byte("probe"), responder.LocalAddr(), 0, func(err error) {
+			t.Errorf("failed to send: %v", err)
+		})
+	}
+
+	for i := 0; i < initiatorsCount; i++ {
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d out of %d probes returned", i, initiatorsCount)
+		}
+	}
+}
+
+func BenchmarkTransponderLoopback(b *testing.B) {
+	const (
+		inflightMax = 64
+		lossTimeout = 100 * time.Millisecond
+	)
+
+	initiator, responder := newLoopback(b, &config.Transponder{
+		BatchSize:    32,
+		ReplyWorkers: 4,
+		Sockets:      1,
+	})
+
+	returned := make(chan struct{}, inflightMax)
+	initiator.Receive = func(_ *transponder.Transponder, _ []byte, _ *net.UDPAddr, _ transponder.Metadata) {
+		returned <- struct{}{}
+	}
+	runTransponder(b, initiator)
+
+	addr := responder.LocalAddr()
+	probe := make([]byte, types.ProbeSize())
+	inflight, lost := 0, 0
+
+	awaitReturn := func() {
+		select {
+		case <-returned:
+		case <-time.After(lossTimeout):
+			lost++
+		}
+		inflight--
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		for inflight >= inflightMax {
+			awaitReturn()
+		}
+		initiator.Send(probe, addr, 0, func(err error) {
+			b.Fatalf("failed to send: %v", err)
+		})
+		inflight++
+	}
+	for inflight > 0 {
+		awaitReturn()
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "probes/s")
+	b.ReportMetric(float64(lost), "lost")
+}
+
+func TestTransponderAddressFamilies(t *testing.T) {
+	cfg := &config.Transponder{BatchSize: 4, ReplyWorkers: 1, Sockets: 1}
+	ip4 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 32123}
+	ip6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 32123}
+
+	for _, tc := range []struct {
+		address  string
+		ip4, ip6 bool
+	}{
+		{"0.0.0.0:32123", true, true}, // dual-stack
+		{"[::]:32123", true, true},
+		{"127.0.0.1:32123", true, false},
+		{"[::1]:32123", false, true},
+	} {
+		tr, err := transponder.New(cfg, tc.address)
+		require.NoError(t, err)
+		require.Equal(t, tc.ip4, tr.CanSendTo(ip4), tc.address)
+		require.Equal(t, tc.ip6, tr.CanSendTo(ip6), tc.address)
+	}
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// DSCPUnknown is reported when the DSCP of a received datagram could not be
+// determined (e.g. the platform does not support IP_RECVTOS).
+const DSCPUnknown uint8 = 0xff
+
+const maxDSCP = 63
+
+var (
+	ErrDSCPInvalid = errors.New("invalid dscp value")
+)
+
+// IsValidDSCP tells whether the dscp fits into the 6 bits of the tos.
+func IsValidDSCP(dscp uint8) bool {
+	return dscp <= maxDSCP
+}
+
+func ParseDSCP(s string) (uint8, error) {
+	dscp, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w",
+			ErrDSCPInvalid, err,
+		)
+	}
+	if dscp < 0 || dscp > maxDSCP {
+		return 0, fmt.Errorf("%w: must be within [0..%d]: %d",
+			ErrDSCPInvalid, maxDSCP, dscp,
+		)
+	}
+	return uint8(dscp), nil
+}
@@ -4,53 +4,125 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 type Peer struct {
 	name string
+	kind string
 
 	host string
 	port int
 
 	udpAddress *net.UDPAddr
 
+	dscp    uint8
+	source  Source
+	buckets string // latency bucket profile
+
+	url     *url.URL // http(s) peers only
+	method  string
+	body    string
+	headers http.Header
+
 	sequence uint64
 }
 
+const (
+	PeerKindHTTP      = "http"       // http(s) endpoint
+	PeerKindICMP      = "icmp"       // anything that replies to icmp echo requests
+	PeerKindQUIC      = "quic"       // another latency-monitor (over quic datagrams)
+	PeerKindTCP       = "tcp"        // anything that accepts tcp connections
+	PeerKindTCPStream = "tcp-stream" // another latency-monitor (over persistent tcp stream)
+	PeerKindTWAMP     = "twamp"      // twamp-light session-reflector (rfc 5357)
+	PeerKindUDP       = "udp"        // another latency-monitor
+)
+
 var (
 	ErrPeerFailedToDecodeStringRepresentation = errors.New("failed to decode peer from its string representation")
 	ErrPeerFailedToResolveIP4                 = errors.New("failed to resolve peer ip4 address")
+	ErrPeerInapplicableOption                 = errors.New("peer option does not apply to the peer kind")
+	ErrPeerInvalidHeader                      = errors.New("invalid peer http header")
+	ErrPeerInvalidSourceIP                    = errors.New("invalid peer source ip")
+	ErrPeerUnknownKind                        = errors.New("unknown peer kind")
+	ErrPeerUnknownOption                      = errors.New("unknown peer option")
 )
 
 func NewPeer(s string) (Peer, error) {
-	p1 := strings.Split(s, "=")
+	p1 := strings.SplitN(s, "=", 2)
 	if len(p1) != 2 {
 		return Peer{}, fmt.Errorf("%w: expected '=' delimiter: %s",
 			ErrPeerFailedToDecodeStringRepresentation, s,
 		)
 	}
 
-	p2 := strings.Split(p1[1], ":")
-	if len(p2) != 2 {
-		return Peer{}, fmt.Errorf("%w: expected ':' delimiter: %s",
-			ErrPeerFailedToDecodeStringRepresentation, s,
+	kind := PeerKindUDP
+	address := p1[1]
+	if scheme, rest, found := strings.Cut(address, "://"); found {
+		switch scheme {
+		case "http", "https":
+			kind = PeerKindHTTP // the scheme stays with the url
+		case PeerKindICMP, PeerKindQUIC, PeerKindTCP, PeerKindTCPStream, PeerKindTWAMP, PeerKindUDP:
+			kind = scheme
+			address = rest
+		default:
+			return Peer{}, fmt.Errorf("%w: %w: %s",
+				ErrPeerFailedToDecodeStringRepresentation, ErrPeerUnknownKind, s,
+			)
+		}
+	}
+
+	options := strings.Split(address, ";")
+	if kind == PeerKindHTTP {
+		options = splitHTTPOptions(address)
+	}
+
+	hostPort := options[0]
+	var u *url.URL
+	if kind == PeerKindHTTP {
+		parsed, err := url.Parse(options[0])
+		if err != nil {
+			return Peer{}, fmt.Errorf("%w: %w: %s",
+				ErrPeerFailedToDecodeStringRepresentation, err, s,
+			)
+		}
+		u = parsed
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		hostPort = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	strHost, strPort, err := net.SplitHostPort(hostPort)
+	if err != nil && kind == PeerKindICMP { // icmp has no ports
+		strHost, strPort, err = strings.Trim(options[0], "[]"), "0", nil
+	}
+	if err != nil {
+		return Peer{}, fmt.Errorf("%w: %w: %s",
+			ErrPeerFailedToDecodeStringRepresentation, err, s,
 		)
 	}
 
-	ip := net.ParseIP(p2[0])
+	ip := net.ParseIP(strHost)
 	host := ""
 	if ip == nil {
-		if _, err := net.LookupIP(p2[0]); err != nil {
+		if _, err := net.LookupIP(strHost); err != nil {
 			return Peer{}, fmt.Errorf("%w: %w: %s",
 				ErrPeerFailedToDecodeStringRepresentation, err, s,
 			)
 		}
-		host = p2[0]
+		host = strHost
 	}
 
-	port, err := strconv.Atoi(p2[1])
+	port, err := strconv.Atoi(strPort)
 	if err != nil {
 		return Peer{}, fmt.Errorf("%w: %w",
 			ErrPeerFailedToDecodeStringRepresentation, err,
@@ -65,27 +137,175 @@ func NewPeer(s string) (Peer, error) {
 		}
 	}
 
-	return Peer{
+	peer := Peer{
 		name: p1[0],
+		kind: kind,
 
 		host: host,
 		port: port,
 
 		udpAddress: udpAddress,
-	}, nil
+
+		url: u,
+	}
+	if kind == PeerKindHTTP {
+		peer.method = http.MethodGet
+		peer.headers = make(http.Header)
+	}
+
+	for _, option := range options[1:] {
+		if err := peer.applyOption(option); err != nil {
+			return Peer{}, fmt.Errorf("%w: %w: %s",
+				ErrPeerFailedToDecodeStringRepresentation, err, s,
+			)
+		}
+	}
+
+	return peer, nil
 }
 
-func (p Peer) Name() string {
+// peerOptions are the keys of the options the peer string can carry.
+var peerOptions = []string{"body", "buckets", "device", "dscp", "header", "method", "source"}
+
+// splitHTTPOptions splits the url of http peer from its options.  Since the
+// url, the headers and the body can have ';' in them, the split only happens at
+// ';' that is followed by the key of a known option.
+func splitHTTPOptions(address string) []string {
+	res := []string{}
+	start := 0
+	for i := 0; i < len(address); i++ {
+		if address[i] != ';' {
+			continue
+		}
+		key, _, found := strings.Cut(address[i+1:], "=")
+		if !found || !slices.Contains(peerOptions, key) {
+			continue
+		}
+		res = append(res, address[start:i])
+		start = i + 1
+	}
+	return append(res, address[start:])
+}
+
+func (p *Peer) applyOption(option string) error {
+	kv := strings.SplitN(option, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected '=' delimiter in option: %s", option)
+	}
+
+	switch {
+	case p.kind == PeerKindHTTP && kv[0] == "method":
+		p.method = strings.ToUpper(kv[1])
+	case p.kind == PeerKindHTTP && kv[0] == "body":
+		p.body = kv[1]
+	case p.kind == PeerKindHTTP && kv[0] == "header":
+		name, value, found := strings.Cut(kv[1], ":")
+		if !found {
+			return fmt.Errorf("%w: %s",
+				ErrPeerInvalidHeader, kv[1],
+			)
+		}
+		p.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	case p.kind == PeerKindQUIC && kv[0] == "dscp", // quic-go overwrites the tos with ecn
+		p.kind == PeerKindHTTP && kv[0] == "buckets": // the phases have the histograms of their own
+		return fmt.Errorf("%w: %s: %s",
+			ErrPeerInapplicableOption, kv[0], p.kind,
+		)
+	case kv[0] == "dscp":
+		dscp, err := ParseDSCP(kv[1])
+		if err != nil {
+			return err
+		}
+		p.dscp = dscp
+	case kv[0] == "buckets":
+		p.buckets = kv[1]
+	case kv[0] == "device":
+		p.source.Device = kv[1]
+	case kv[0] == "source":
+		ip := net.ParseIP(kv[1])
+		if ip == nil {
+			return fmt.Errorf("%w: %s",
+				ErrPeerInvalidSourceIP, kv[1],
+			)
+		}
+		p.source.IP = ip
+	default:
+		return fmt.Errorf("%w: %s",
+			ErrPeerUnknownOption, kv[0],
+		)
+	}
+
+	return nil
+}
+
+func (p *Peer) Name() string {
 	return p.name
 }
 
+// Address is the address of the peer the way it was configured (the url for
+// http(s) peers, without the credentials since it ends up in the metrics).
+func (p *Peer) Address() string {
+	if p.url != nil {
+		u := *p.url
+		u.User = nil
+		return u.String()
+	}
+	host := p.host
+	if host == "" {
+		host = p.udpAddress.IP.String()
+	}
+	if p.kind == PeerKindICMP {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p.port))
+}
+
+// Kind tells what is on the other side of the peer (see PeerKindXXX).
+func (p *Peer) Kind() string {
+	return p.kind
+}
+
+// URL is the endpoint of http(s) peer (nil for the other kinds).
+func (p *Peer) URL() *url.URL {
+	return p.url
+}
+
+// Method is the http method of the requests to http(s) peer.
+func (p *Peer) Method() string {
+	return p.method
+}
+
+// Body is the body of the requests to http(s) peer.
+func (p *Peer) Body() string {
+	return p.body
+}
+
+// Header is the extra headers of the requests to http(s) peer.
+func (p *Peer) Header() http.Header {
+	return p.headers
+}
+
+func (p *Peer) DSCP() uint8 {
+	return p.dscp
+}
+
+func (p *Peer) Source() Source {
+	return p.source
+}
+
+// BucketProfile is the name of latency bucket profile of the peer's histograms
+// (empty for the default one).
+func (p *Peer) BucketProfile() string {
+	return p.buckets
+}
+
 func (p *Peer) Sequence() uint64 {
 	res := p.sequence
 	p.sequence += 1
 	return res
 }
 
-func (p Peer) UDPAddress() (*net.UDPAddr, error) {
+func (p *Peer) UDPAddress() (*net.UDPAddr, error) {
 	if p.udpAddress != nil {
 		return p.udpAddress, nil
 	}
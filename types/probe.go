@@ -17,9 +17,17 @@ type Probe struct {
 	DstUUID      uuid.UUID
 	DstTimestamp time.Time
 	DstLocation  Location
+	SrcDSCP      uint8 // dscp the probe was sent with
+	DstDSCP      uint8 // dscp the probe was received with by the destination
 }
 
 func ProbeSize() int {
+	return 144
+}
+
+// LegacyProbeSize is the size of the probes of the peers that predate the
+// dscp (they have neither SrcDSCP nor DstDSCP).
+func LegacyProbeSize() int {
 	return 142
 }
 
@@ -50,15 +58,17 @@ func (p Probe) MarshalBinary() ([]byte, error) {
 	copy(data[39:75], p.SrcLocation[:])                  // 039..074  : 36 bytes
 	copy(data[75:91], p.DstUUID[:])                      // 075..090  : 16 bytes
 	copy(data[91:106], rawDstTimestamp)                  // 091..105  : 15 bytes
-	copy(data[106:142], p.DstLocation[:])                // 106..142  : 36 bytes
+	copy(data[106:142], p.DstLocation[:])                // 106..141  : 36 bytes
+	data[142] = p.SrcDSCP                                // 142       : 1 byte
+	data[143] = p.DstDSCP                                // 143       : 1 byte
 
 	return data, nil
 }
 
 func (p *Probe) UnmarshalBinary(data []byte) error {
-	if len(data) != ProbeSize() {
-		return fmt.Errorf("%w: invalid binary length: expected %d, got %d",
-			ErrProbeFailedToDecodeBinaryRepresentation, ProbeSize(), len(data),
+	if len(data) != ProbeSize() && len(data) != LegacyProbeSize() {
+		return fmt.Errorf("%w: invalid binary length: expected %d (or %d), got %d",
+			ErrProbeFailedToDecodeBinaryRepresentation, ProbeSize(), LegacyProbeSize(), len(data),
 		)
 	}
 
@@ -96,6 +106,17 @@ func (p *Probe) UnmarshalBinary(data []byte) error {
 	dstLocation := Location{}
 	copy(dstLocation[:], data[106:142])
 
+	srcDSCP, dstDSCP := DSCPUnknown, DSCPUnknown
+	if len(data) == ProbeSize() {
+		srcDSCP, dstDSCP = data[142], data[143]
+	}
+	if !IsValidDSCP(srcDSCP) { // it comes from the wire, and goes into the tos
+		srcDSCP = DSCPUnknown
+	}
+	if !IsValidDSCP(dstDSCP) {
+		dstDSCP = DSCPUnknown
+	}
+
 	*p = Probe{
 		Sequence:     binary.LittleEndian.Uint64(data[:8]),
 		SrcUUID:      srcUUID,
@@ -104,6 +125,8 @@ func (p *Probe) UnmarshalBinary(data []byte) error {
 		DstUUID:      dstUUID,
 		DstTimestamp: *dstTimestamp,
 		DstLocation:  dstLocation,
+		SrcDSCP:      srcDSCP,
+		DstDSCP:      dstDSCP,
 	}
 
 	return nil
@@ -24,6 +24,8 @@ func TestProbeEncodeDecode(t *testing.T) {
 		DstUUID:      uuid.New(),
 		DstTimestamp: time.Now(),
 		DstLocation:  types.Location(dstLocation),
+		SrcDSCP:      46,
+		DstDSCP:      types.DSCPUnknown,
 	}
 
 	b, err := pOrg.MarshalBinary()
@@ -40,7 +42,43 @@ func TestProbeEncodeDecode(t *testing.T) {
 	require.Equal(t, pOrg.DstUUID, pRes.DstUUID)
 	require.Equal(t, pOrg.DstTimestamp.UnixNano(), pRes.DstTimestamp.UnixNano()) // otherwise, monotonic clock will drift
 	require.Equal(t, pOrg.DstLocation, pRes.DstLocation)
+	require.Equal(t, pOrg.SrcDSCP, pRes.SrcDSCP)
+	require.Equal(t, pOrg.DstDSCP, pRes.DstDSCP)
 
 	t.Logf("Src: %s", pRes.SrcLocation.String())
 	t.Logf("Dst: %s", pRes.DstLocation.String())
 }
+
+func TestProbeDecodeLegacy(t *testing.T) {
+	pOrg := types.Probe{
+		Sequence:     42,
+		SrcUUID:      uuid.New(),
+		SrcTimestamp: time.Now(),
+		DstUUID:      uuid.New(),
+		SrcDSCP:      46,
+	}
+
+	b, err := pOrg.MarshalBinary()
+	require.NoError(t, err)
+	b = b[:types.LegacyProbeSize()] // as sent by the peers that predate dscp
+
+	pRes := &types.Probe{}
+	require.NoError(t, pRes.UnmarshalBinary(b))
+	require.Equal(t, pOrg.Sequence, pRes.Sequence)
+	require.Equal(t, pOrg.SrcUUID, pRes.SrcUUID)
+	require.Equal(t, types.DSCPUnknown, pRes.SrcDSCP)
+	require.Equal(t, types.DSCPUnknown, pRes.DstDSCP)
+
+	require.Error(t, pRes.UnmarshalBinary(b[:types.LegacyProbeSize()-1]))
+}
+
+func TestProbeDecodeInvalidDSCP(t *testing.T) {
+	b, err := types.Probe{SrcDSCP: 46, DstDSCP: 46}.MarshalBinary()
+	require.NoError(t, err)
+	b[142], b[143] = 64, 200 // beyond the 6 bits of the tos
+
+	p := &types.Probe{}
+	require.NoError(t, p.UnmarshalBinary(b))
+	require.Equal(t, types.DSCPUnknown, p.SrcDSCP)
+	require.Equal(t, types.DSCPUnknown, p.DstDSCP)
+}
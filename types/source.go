@@ -0,0 +1,26 @@
+package types
+
+import (
+	"net"
+)
+
+// Source is the local address and/or network device to send probes from.
+type Source struct {
+	IP     net.IP
+	Device string
+}
+
+func (s Source) IsZero() bool {
+	return s.IP == nil && s.Device == ""
+}
+
+func (s Source) String() string {
+	switch {
+	case s.IP == nil:
+		return s.Device
+	case s.Device == "":
+		return s.IP.String()
+	default:
+		return s.IP.String() + "%" + s.Device
+	}
+}
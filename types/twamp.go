@@ -0,0 +1,131 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TWAMPSenderPacket is the unauthenticated TWAMP-Light test packet sent by
+// the session-sender (RFC 5357, section 4.1.2).
+type TWAMPSenderPacket struct {
+	Sequence      uint32
+	Timestamp     time.Time
+	ErrorEstimate uint16
+	PaddingSize   int
+}
+
+// TWAMPReflectorPacket is the unauthenticated TWAMP-Light test packet sent
+// back by the session-reflector (RFC 5357, section 4.2.1).
+type TWAMPReflectorPacket struct {
+	Sequence            uint32
+	Timestamp           time.Time
+	ErrorEstimate       uint16
+	ReceiveTimestamp    time.Time
+	SenderSequence      uint32
+	SenderTimestamp     time.Time
+	SenderErrorEstimate uint16
+	SenderTTL           uint8
+	PaddingSize         int
+}
+
+// TWAMPErrorEstimateUnknown is the error estimate of a clock that is not
+// synchronised to any external source (S=0, Z=0, scale=0, multiplier=1).
+const TWAMPErrorEstimateUnknown uint16 = 0x0001
+
+// ntpEpochOffset is the count of seconds between 1900-01-01 and 1970-01-01.
+const ntpEpochOffset = 2208988800
+
+func TWAMPSenderPacketSize() int {
+	return 14
+}
+
+func TWAMPReflectorPacketSize() int {
+	return 41
+}
+
+var (
+	ErrTWAMPFailedToDecodeBinaryRepresentation = errors.New("failed to decode twamp test packet from its binary representation")
+)
+
+func (p TWAMPSenderPacket) MarshalBinary() ([]byte, error) {
+	data := make([]byte, TWAMPSenderPacketSize()+p.PaddingSize)
+
+	binary.BigEndian.PutUint32(data[0:4], p.Sequence)        // 00..03  : 4 bytes
+	putNTPTimestamp(data[4:12], p.Timestamp)                 // 04..11  : 8 bytes
+	binary.BigEndian.PutUint16(data[12:14], p.ErrorEstimate) // 12..13  : 2 bytes
+
+	return data, nil
+}
+
+func (p *TWAMPSenderPacket) UnmarshalBinary(data []byte) error {
+	if len(data) < TWAMPSenderPacketSize() {
+		return fmt.Errorf("%w: invalid binary length: expected at least %d, got %d",
+			ErrTWAMPFailedToDecodeBinaryRepresentation, TWAMPSenderPacketSize(), len(data),
+		)
+	}
+
+	*p = TWAMPSenderPacket{
+		Sequence:      binary.BigEndian.Uint32(data[0:4]),
+		Timestamp:     ntpTimestamp(data[4:12]),
+		ErrorEstimate: binary.BigEndian.Uint16(data[12:14]),
+		PaddingSize:   len(data) - TWAMPSenderPacketSize(),
+	}
+
+	return nil
+}
+
+func (p TWAMPReflectorPacket) MarshalBinary() ([]byte, error) {
+	data := make([]byte, TWAMPReflectorPacketSize()+p.PaddingSize)
+
+	binary.BigEndian.PutUint32(data[0:4], p.Sequence)              // 00..03  : 4 bytes
+	putNTPTimestamp(data[4:12], p.Timestamp)                       // 04..11  : 8 bytes
+	binary.BigEndian.PutUint16(data[12:14], p.ErrorEstimate)       // 12..13  : 2 bytes
+	binary.BigEndian.PutUint16(data[14:16], 0)                     // 14..15  : 2 bytes (MBZ)
+	putNTPTimestamp(data[16:24], p.ReceiveTimestamp)               // 16..23  : 8 bytes
+	binary.BigEndian.PutUint32(data[24:28], p.SenderSequence)      // 24..27  : 4 bytes
+	putNTPTimestamp(data[28:36], p.SenderTimestamp)                // 28..35  : 8 bytes
+	binary.BigEndian.PutUint16(data[36:38], p.SenderErrorEstimate) // 36..37  : 2 bytes
+	binary.BigEndian.PutUint16(data[38:40], 0)                     // 38..39  : 2 bytes (MBZ)
+	data[40] = p.SenderTTL                                         // 40      : 1 byte
+
+	return data, nil
+}
+
+func (p *TWAMPReflectorPacket) UnmarshalBinary(data []byte) error {
+	if len(data) < TWAMPReflectorPacketSize() {
+		return fmt.Errorf("%w: invalid binary length: expected at least %d, got %d",
+			ErrTWAMPFailedToDecodeBinaryRepresentation, TWAMPReflectorPacketSize(), len(data),
+		)
+	}
+
+	*p = TWAMPReflectorPacket{
+		Sequence:            binary.BigEndian.Uint32(data[0:4]),
+		Timestamp:           ntpTimestamp(data[4:12]),
+		ErrorEstimate:       binary.BigEndian.Uint16(data[12:14]),
+		ReceiveTimestamp:    ntpTimestamp(data[16:24]),
+		SenderSequence:      binary.BigEndian.Uint32(data[24:28]),
+		SenderTimestamp:     ntpTimestamp(data[28:36]),
+		SenderErrorEstimate: binary.BigEndian.Uint16(data[36:38]),
+		SenderTTL:           data[40],
+		PaddingSize:         len(data) - TWAMPReflectorPacketSize(),
+	}
+
+	return nil
+}
+
+func putNTPTimestamp(data []byte, t time.Time) {
+	seconds := uint32(t.Unix() + ntpEpochOffset)
+	fraction := uint32((uint64(t.Nanosecond()) << 32) / uint64(time.Second))
+
+	binary.BigEndian.PutUint32(data[0:4], seconds)
+	binary.BigEndian.PutUint32(data[4:8], fraction)
+}
+
+func ntpTimestamp(data []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(data[0:4])) - ntpEpochOffset
+	fraction := uint64(binary.BigEndian.Uint32(data[4:8]))
+
+	return time.Unix(seconds, int64((fraction*uint64(time.Second))>>32))
+}
@@ -0,0 +1,61 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flashbots/latency-monitor/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTWAMPEncodeDecode(t *testing.T) {
+	sOrg := types.TWAMPSenderPacket{
+		Sequence:      42,
+		Timestamp:     time.Now(),
+		ErrorEstimate: types.TWAMPErrorEstimateUnknown,
+		PaddingSize:   27,
+	}
+
+	b, err := sOrg.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, b, types.TWAMPReflectorPacketSize())
+
+	sRes := &types.TWAMPSenderPacket{}
+	err = sRes.UnmarshalBinary(b)
+	require.NoError(t, err)
+
+	require.Equal(t, sOrg.Sequence, sRes.Sequence)
+	require.InDelta(t, sOrg.Timestamp.UnixNano(), sRes.Timestamp.UnixNano(), 1) // ntp fraction is ~233ps
+	require.Equal(t, sOrg.ErrorEstimate, sRes.ErrorEstimate)
+	require.Equal(t, sOrg.PaddingSize, sRes.PaddingSize)
+
+	rOrg := types.TWAMPReflectorPacket{
+		Sequence:            sRes.Sequence,
+		Timestamp:           time.Now(),
+		ErrorEstimate:       types.TWAMPErrorEstimateUnknown,
+		ReceiveTimestamp:    time.Now(),
+		SenderSequence:      sRes.Sequence,
+		SenderTimestamp:     sRes.Timestamp,
+		SenderErrorEstimate: sRes.ErrorEstimate,
+		SenderTTL:           64,
+	}
+
+	b, err = rOrg.MarshalBinary()
+	require.NoError(t, err)
+
+	rRes := &types.TWAMPReflectorPacket{}
+	err = rRes.UnmarshalBinary(b)
+	require.NoError(t, err)
+
+	require.Equal(t, rOrg.Sequence, rRes.Sequence)
+	require.InDelta(t, rOrg.Timestamp.UnixNano(), rRes.Timestamp.UnixNano(), 1)
+	require.InDelta(t, rOrg.ReceiveTimestamp.UnixNano(), rRes.ReceiveTimestamp.UnixNano(), 1)
+	require.Equal(t, rOrg.SenderSequence, rRes.SenderSequence)
+	require.InDelta(t, rOrg.SenderTimestamp.UnixNano(), rRes.SenderTimestamp.UnixNano(), 1)
+	require.Equal(t, rOrg.SenderErrorEstimate, rRes.SenderErrorEstimate)
+	require.Equal(t, rOrg.SenderTTL, rRes.SenderTTL)
+	require.Equal(t, 0, rRes.PaddingSize)
+
+	err = rRes.UnmarshalBinary(b[:types.TWAMPSenderPacketSize()])
+	require.ErrorIs(t, err, types.ErrTWAMPFailedToDecodeBinaryRepresentation)
+}